@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/auth"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+// How many stored messages are read at a time when looking for those already imported.
+const importBatchSize = 500
+
+// Characters that may not appear in a user name, which must stay resolvable as an @name mention.
+var invalidUserNameChars = regexp.MustCompile(`[^\w.\-]+`)
+
+type importStats struct {
+	users, rooms, messages, skipped int
+}
+
+type importer struct {
+	ur  repository.UserRepository
+	rr  repository.RoomRepository
+	mr  repository.MessageRepository
+	rer repository.ReactionRepository
+
+	// users and rooms hold the existing users and rooms by name.
+	users map[string]*entity.User
+	rooms map[string]*entity.Room
+	// userIDs and roomIDs map Slack IDs to ours.
+	userIDs   map[string]string
+	userNames map[string]string
+	roomIDs   map[string]string
+	// channelNames maps Slack channel IDs to their names, for #channel references.
+	channelNames map[string]string
+	// credentials receives the name and generated password of every user created.
+	credentials func(name string, password string) error
+	// progress logs the outcome of every channel.
+	progress *log.Logger
+
+	stats importStats
+}
+
+func newImporter(ur repository.UserRepository, rr repository.RoomRepository, mr repository.MessageRepository, rer repository.ReactionRepository, credentials func(name string, password string) error, progress *log.Logger) *importer {
+	return &importer{
+		ur:           ur,
+		rr:           rr,
+		mr:           mr,
+		rer:          rer,
+		users:        make(map[string]*entity.User),
+		rooms:        make(map[string]*entity.Room),
+		userIDs:      make(map[string]string),
+		userNames:    make(map[string]string),
+		roomIDs:      make(map[string]string),
+		channelNames: make(map[string]string),
+		credentials:  credentials,
+		progress:     progress,
+	}
+}
+
+// Import copies the users, channels and message history of the export. Users and rooms
+// whose names already exist are reused, and messages are identified by their Slack
+// channel and timestamp, so running it again over the same export adds nothing twice.
+func (im *importer) Import(ctx context.Context, export *slackExport) error {
+	existing, err := im.ur.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range existing {
+		im.users[user.Name] = user
+	}
+	rooms, err := im.rr.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, room := range rooms {
+		im.rooms[room.Name] = room
+	}
+
+	users, err := export.users()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err = im.importUser(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	channels, err := export.channels()
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		im.channelNames[channel.ID] = channel.Name
+	}
+	for _, channel := range channels {
+		if err = im.importChannel(ctx, channel); err != nil {
+			return err
+		}
+		imported := im.stats.messages
+		if err = im.importMessages(ctx, export, channel); err != nil {
+			return err
+		}
+		im.progress.Printf("#%s: imported %d messages", channel.Name, im.stats.messages-imported)
+	}
+	return nil
+}
+
+func (im *importer) importUser(ctx context.Context, slack slackUser) error {
+	name := userName(slack)
+	if user, ok := im.users[name]; ok {
+		im.userIDs[slack.ID] = user.ID
+		im.userNames[slack.ID] = user.Name
+		return nil
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	hash, err := auth.PasswordEncrypt(password)
+	if err != nil {
+		return err
+	}
+	user := &entity.User{
+		ID:       uuid.New().String(),
+		Name:     name,
+		Password: hash,
+	}
+	if err = im.ur.Create(ctx, *user); err != nil {
+		return err
+	}
+	if err = im.credentials(name, password); err != nil {
+		return err
+	}
+	im.users[name] = user
+	im.userIDs[slack.ID] = user.ID
+	im.userNames[slack.ID] = user.Name
+	im.stats.users++
+	return nil
+}
+
+func (im *importer) importChannel(ctx context.Context, channel slackChannel) error {
+	room, ok := im.rooms[channel.Name]
+	if !ok {
+		room = &entity.Room{
+			ID:      uuid.New().String(),
+			Name:    channel.Name,
+			Private: channel.Private,
+		}
+		if err := im.rr.Create(ctx, *room); err != nil {
+			return err
+		}
+		if channel.Topic.Value != "" {
+			topic, _ := convertText(channel.Topic.Value, im.userNames, im.channelNames)
+			if len(topic) > config.MaxTopicSize {
+				topic = topic[:config.MaxTopicSize]
+			}
+			if err := im.rr.UpdateTopic(ctx, room.ID, topic); err != nil {
+				return err
+			}
+		}
+		im.rooms[channel.Name] = room
+		im.stats.rooms++
+	}
+	im.roomIDs[channel.ID] = room.ID
+
+	for _, member := range channel.Members {
+		if userID, ok := im.userIDs[member]; ok {
+			if err := im.rr.AddMember(ctx, room.ID, userID); err != nil {
+				return err
+			}
+		}
+	}
+	if creatorID, ok := im.userIDs[channel.Creator]; ok {
+		if err := im.rr.AddModerator(ctx, room.ID, creatorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) importMessages(ctx context.Context, export *slackExport, channel slackChannel) error {
+	roomID := im.roomIDs[channel.ID]
+	// Thread replies keep their parent when it was imported.
+	imported := make(map[string]bool)
+
+	for _, dayFile := range export.dayFiles(channel.Name) {
+		messages, err := export.messages(dayFile)
+		if err != nil {
+			return err
+		}
+		stored, err := im.storedMessageIDs(ctx, roomID, messages)
+		if err != nil {
+			return err
+		}
+		for _, slack := range messages {
+			senderID, ok := im.userIDs[slack.User]
+			if slack.Type != "message" || !importedSubtypes[slack.Subtype] || !ok {
+				im.stats.skipped++
+				continue
+			}
+			createdAt, err := parseSlackTS(slack.TS)
+			if err != nil {
+				log.Printf("Skipping message in %s: %v", dayFile, err)
+				im.stats.skipped++
+				continue
+			}
+
+			id := messageID(channel.ID, slack.TS, createdAt.UnixMicro())
+			if stored[id] {
+				imported[id] = true
+				continue
+			}
+
+			message := entity.Message{
+				ID:        id,
+				TargetID:  roomID,
+				SenderID:  senderID,
+				CreatedAt: createdAt,
+			}
+			var mentions []string
+			message.Content, mentions = convertText(slack.Text, im.userNames, im.channelNames)
+			if slack.Subtype == "me_message" {
+				message.Content = "*" + im.userNames[slack.User] + " " + message.Content + "*"
+			}
+			for _, file := range slack.Files {
+				message.Content = strings.TrimSpace(message.Content + "\n\n📎 [" + file.Name + "](" + file.Permalink + ")")
+			}
+			for _, mention := range mentions {
+				if userID, ok := im.userIDs[mention]; ok && userID != senderID {
+					message.Mentions = append(message.Mentions, userID)
+				}
+			}
+			if slack.ThreadTS != "" && slack.ThreadTS != slack.TS {
+				if parentAt, err := parseSlackTS(slack.ThreadTS); err == nil {
+					if parentID := messageID(channel.ID, slack.ThreadTS, parentAt.UnixMicro()); imported[parentID] {
+						message.ParentID = parentID
+					}
+				}
+			}
+
+			if err = im.mr.Create(ctx, message); err != nil {
+				return err
+			}
+			imported[id] = true
+			im.stats.messages++
+
+			for _, reaction := range slack.Reactions {
+				for _, user := range reaction.Users {
+					userID, ok := im.userIDs[user]
+					if !ok {
+						continue
+					}
+					err = im.rer.Add(ctx, entity.Reaction{MessageID: id, UserID: userID, Emoji: ":" + reaction.Name + ":"})
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// storedMessageIDs returns the IDs of the messages of the room stored at the times of
+// the Slack messages, which are those an earlier import already copied.
+func (im *importer) storedMessageIDs(ctx context.Context, roomID string, messages []slackMessage) (map[string]bool, error) {
+	var from, to time.Time
+	for _, slack := range messages {
+		createdAt, err := parseSlackTS(slack.TS)
+		if err != nil {
+			continue
+		}
+		if from.IsZero() || createdAt.Before(from) {
+			from = createdAt
+		}
+		if createdAt.After(to) {
+			to = createdAt
+		}
+	}
+
+	stored := make(map[string]bool)
+	if from.IsZero() {
+		return stored, nil
+	}
+	var afterID string
+	for {
+		page, err := im.mr.ListRange(ctx, roomID, afterID, from, to.Add(time.Microsecond), importBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range page {
+			stored[message.ID] = true
+		}
+		if len(page) < importBatchSize {
+			return stored, nil
+		}
+		afterID = page[len(page)-1].ID
+	}
+}
+
+// userName picks the Slack handle of a user, made into a valid user name here.
+func userName(slack slackUser) string {
+	name := slack.Name
+	if name == "" {
+		name = slack.Profile.DisplayName
+	}
+	name = invalidUserNameChars.ReplaceAllString(name, "_")
+	if name == "" {
+		name = slack.ID
+	}
+	if len(name) > config.MaxUserNameSize {
+		name = name[:config.MaxUserNameSize]
+	}
+	return name
+}
+
+// messageID returns a UUIDv7 for the time the message was sent, so that imported history
+// sorts among other messages by time. The random bits are taken from the Slack channel
+// and timestamp instead, which identify the message across imports.
+func messageID(channelID string, ts string, unixMicro int64) string {
+	sum := sha256.Sum256([]byte(channelID + "/" + ts))
+
+	var id uuid.UUID
+	ms := uint64(unixMicro / 1000)
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	// The microseconds within the millisecond keep messages sent in it in order.
+	sub := uint16(unixMicro % 1000)
+	id[6] = 0x70 | byte(sub>>8)
+	id[7] = byte(sub)
+	copy(id[8:], sum[:8])
+	id[8] = 0x80 | id[8]&0x3f
+	return id.String()
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+// Command import copies the users, channels and message history of a Slack workspace
+// export into the chat database.
+//
+//	go run ./cmd/import -file export.zip -credentials credentials.csv
+//
+// Every user created is given a random password, written with their name to the
+// credentials file so that it can be handed out. Direct messages are not imported.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/repository/sqlite"
+)
+
+func main() {
+	var file, credentialsFile string
+	var verbose bool
+	flag.StringVar(&file, "file", "", "path of the Slack export zip")
+	flag.StringVar(&credentialsFile, "credentials", "credentials.csv", "file to append the names and passwords of created users to")
+	flag.BoolVar(&verbose, "v", false, "log the number of messages imported into every channel")
+	flag.Parse()
+
+	log.SetFlags(0)
+	if file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	logger := log.New(os.Stderr, "", 0)
+	progress := log.New(io.Discard, "", 0)
+	if verbose {
+		progress.SetOutput(os.Stderr)
+	}
+
+	if err := run(file, credentialsFile, logger, progress); err != nil {
+		logger.Printf("Import failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+func run(file string, credentialsFile string, logger *log.Logger, progress *log.Logger) error {
+	export, err := openSlackExport(file)
+	if err != nil {
+		return err
+	}
+	defer export.Close()
+
+	f, err := os.OpenFile(credentialsFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	credentials := csv.NewWriter(f)
+	writeCredentials := func(name string, password string) error {
+		if err := credentials.Write([]string{name, password}); err != nil {
+			return err
+		}
+		credentials.Flush()
+		return credentials.Error()
+	}
+
+	db := config.InitDB()
+	defer db.Close()
+
+	im := newImporter(
+		sqlite.NewUserRepository(db),
+		sqlite.NewRoomRepository(db),
+		sqlite.NewMessageRepository(db),
+		sqlite.NewReactionRepository(db),
+		writeCredentials,
+		progress,
+	)
+	err = im.Import(context.Background(), export)
+	logger.Printf(
+		"Imported %d users, %d rooms and %d messages; skipped %d messages",
+		im.stats.users, im.stats.rooms, im.stats.messages, im.stats.skipped,
+	)
+	return err
+}
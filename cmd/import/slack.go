@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The parts of a Slack workspace export that are imported. The archive holds users.json,
+// channels.json (public channels), groups.json (private channels) and a directory per
+// channel with one <YYYY-MM-DD>.json array of messages per day.
+type slackUser struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+	IsBot   bool   `json:"is_bot"`
+	Profile struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Creator string   `json:"creator"`
+	Members []string `json:"members"`
+	Topic   struct {
+		Value string `json:"value"`
+	} `json:"topic"`
+	Private bool `json:"-"`
+}
+
+type slackMessage struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	User      string `json:"user"`
+	Text      string `json:"text"`
+	TS        string `json:"ts"`
+	ThreadTS  string `json:"thread_ts"`
+	Reactions []struct {
+		Name  string   `json:"name"`
+		Users []string `json:"users"`
+	} `json:"reactions"`
+	Files []struct {
+		Name      string `json:"name"`
+		Permalink string `json:"permalink"`
+	} `json:"files"`
+}
+
+// Subtypes that carry something a member wrote. Joins, leaves, topic changes and the like
+// are left out, as are bot messages, which have no user to send them.
+var importedSubtypes = map[string]bool{
+	"":                 true,
+	"me_message":       true,
+	"thread_broadcast": true,
+	"file_share":       true,
+}
+
+type slackExport struct {
+	zr *zip.ReadCloser
+	// files maps the path of each file in the archive to it.
+	files map[string]*zip.File
+}
+
+func openSlackExport(name string) (*slackExport, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	export := &slackExport{
+		zr:    zr,
+		files: make(map[string]*zip.File),
+	}
+	for _, f := range zr.File {
+		export.files[f.Name] = f
+	}
+	return export, nil
+}
+
+func (se *slackExport) Close() error {
+	return se.zr.Close()
+}
+
+// Decode the JSON file at name into v. A missing file leaves v untouched.
+func (se *slackExport) decode(name string, v any) error {
+	f, ok := se.files[name]
+	if !ok {
+		return nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err = json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (se *slackExport) users() ([]slackUser, error) {
+	var users []slackUser
+	if err := se.decode("users.json", &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (se *slackExport) channels() ([]slackChannel, error) {
+	var channels, groups []slackChannel
+	if err := se.decode("channels.json", &channels); err != nil {
+		return nil, err
+	}
+	if err := se.decode("groups.json", &groups); err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i].Private = true
+	}
+	return append(channels, groups...), nil
+}
+
+// dayFiles returns the paths of the daily message files of a channel, oldest first.
+func (se *slackExport) dayFiles(channelName string) []string {
+	var names []string
+	for name := range se.files {
+		if dir, file := path.Split(name); dir == channelName+"/" && path.Ext(file) == ".json" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// messages returns the messages of a daily file, oldest first.
+func (se *slackExport) messages(dayFile string) ([]slackMessage, error) {
+	var messages []slackMessage
+	if err := se.decode(dayFile, &messages); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].TS < messages[j].TS
+	})
+	return messages, nil
+}
+
+// parseSlackTS converts a message timestamp such as "1512085950.000216" to a time.
+func parseSlackTS(ts string) (time.Time, error) {
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+	}
+	var micro int64
+	if frac != "" {
+		frac = (frac + "000000")[:6]
+		if micro, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+		}
+	}
+	return time.Unix(s, micro*1000).UTC(), nil
+}
+
+var (
+	slackTokenPattern = regexp.MustCompile(`<([^<>\n]+)>`)
+	slackBoldPattern  = regexp.MustCompile(`(^|[\s(])\*([^*\n]+)\*`)
+	htmlEntities      = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+)
+
+// convertText rewrites Slack's mrkdwn into the Markdown messages are written in. userNames
+// and channelNames map Slack IDs to names here; mentions holds the Slack IDs of the users
+// mentioned.
+func convertText(text string, userNames map[string]string, channelNames map[string]string) (string, []string) {
+	var mentions []string
+	text = slackTokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+		target, label, _ := strings.Cut(token[1:len(token)-1], "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			id := target[1:]
+			if name, ok := userNames[id]; ok {
+				mentions = append(mentions, id)
+				return "@" + name
+			}
+			if label != "" {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return "@" + id
+		case strings.HasPrefix(target, "#"):
+			if label == "" {
+				label = channelNames[target[1:]]
+			}
+			return "#" + label
+		case strings.HasPrefix(target, "!"):
+			// Special mentions such as <!here>, and dates and user groups with a fallback label.
+			if label != "" {
+				return label
+			}
+			name, _, _ := strings.Cut(target[1:], "^")
+			return "@" + name
+		default:
+			if label == "" {
+				return target
+			}
+			return "[" + label + "](" + target + ")"
+		}
+	})
+
+	// Slack's *bold* is Markdown's **bold**; code is left as written.
+	segments := strings.Split(text, "`")
+	for i := 0; i < len(segments); i += 2 {
+		segments[i] = slackBoldPattern.ReplaceAllString(segments[i], "$1**$2**")
+	}
+	return htmlEntities.Replace(strings.Join(segments, "`")), mentions
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"flag"
 	"log"
@@ -16,8 +17,10 @@ import (
 	"github.com/tusmasoma/simple-chat/config"
 	"github.com/tusmasoma/simple-chat/interface/handler"
 	"github.com/tusmasoma/simple-chat/interface/middleware"
+	"github.com/tusmasoma/simple-chat/repository/disk"
 	"github.com/tusmasoma/simple-chat/repository/redis"
 	"github.com/tusmasoma/simple-chat/repository/sqlite"
+	"github.com/tusmasoma/simple-chat/repository/webhook"
 	"github.com/tusmasoma/simple-chat/repository/websocket"
 	"github.com/tusmasoma/simple-chat/usecase"
 )
@@ -29,9 +32,13 @@ func main() {
 
 	ctx := context.Background()
 
+	// The repositories share the connection for as long as the server runs.
+	db := config.InitDB()
+	defer db.Close()
+
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: Init(ctx),
+		Handler: Init(ctx, db),
 	}
 
 	/* ===== サーバの起動 ===== */
@@ -59,24 +66,47 @@ func main() {
 	log.Println("Server exited")
 }
 
-func Init(ctx context.Context) *chi.Mux {
-	db := config.InitDB()
-	defer db.Close()
-
+func Init(ctx context.Context, db *sql.DB) *chi.Mux {
 	cacheClient := config.NewClient()
 
 	userRepo := sqlite.NewUserRepository(db)
 	userCacehRepo := redis.NewUserRepository(cacheClient)
 	roomRepo := sqlite.NewRoomRepository(db)
+	messageRepo := sqlite.NewMessageRepository(db)
+	reactionRepo := sqlite.NewReactionRepository(db)
+	readCursorRepo := sqlite.NewReadCursorRepository(db)
+	attachmentRepo := sqlite.NewAttachmentRepository(db)
+	scheduledMessageRepo := sqlite.NewScheduledMessageRepository(db)
+	incomingWebhookRepo := sqlite.NewIncomingWebhookRepository(db)
+	outgoingWebhookRepo := sqlite.NewOutgoingWebhookRepository(db)
+	webhookDispatcher := webhook.NewWebhookDispatcher(outgoingWebhookRepo, webhook.NewClient(), config.WebhookInitialBackoff)
+	blobStore := disk.NewBlobStore(config.AttachmentDir)
 
 	pubsubRepo := redis.NewPubSubRepository(cacheClient)
+	nonceRepo := redis.NewNonceRepository(cacheClient)
+	lockRepo := redis.NewLockRepository(cacheClient)
 
-	hub := websocket.NewHubWebSocketRepository(ctx, roomRepo, userRepo, pubsubRepo)
+	hub := websocket.NewHubWebSocketRepository(ctx, roomRepo, userRepo, pubsubRepo, messageRepo, reactionRepo, readCursorRepo, nonceRepo, attachmentRepo, scheduledMessageRepo, lockRepo, webhookDispatcher)
 
 	userUseCase := usecase.NewUserUseCase(userRepo, userCacehRepo)
+	messageUseCase := usecase.NewMessageUseCase(messageRepo, reactionRepo, readCursorRepo, attachmentRepo, roomRepo)
+	searchUseCase := usecase.NewSearchUseCase(messageRepo, roomRepo, userRepo)
+	exportUseCase := usecase.NewExportUseCase(messageRepo, roomRepo, userRepo, reactionRepo, attachmentRepo)
+	roomUseCase := usecase.NewRoomUseCase(roomRepo, messageRepo, userRepo)
+	retentionUseCase := usecase.NewRetentionUseCase(roomRepo, messageRepo, attachmentRepo, blobStore)
+	attachmentUseCase := usecase.NewAttachmentUseCase(attachmentRepo, roomRepo, messageRepo, blobStore)
+	scheduleUseCase := usecase.NewScheduleUseCase(scheduledMessageRepo, roomRepo, messageRepo)
+	webhookUseCase := usecase.NewWebhookUseCase(incomingWebhookRepo, outgoingWebhookRepo, roomRepo, messageRepo, userRepo, pubsubRepo, webhookDispatcher)
 
 	wsHandler := handler.NewWebsocketHandler(hub, nil)
 	userHandler := handler.NewUserHandler(userUseCase)
+	messageHandler := handler.NewMessageHandler(messageUseCase)
+	searchHandler := handler.NewSearchHandler(searchUseCase)
+	exportHandler := handler.NewExportHandler(exportUseCase)
+	roomHandler := handler.NewRoomHandler(roomUseCase)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentUseCase)
+	scheduleHandler := handler.NewScheduleHandler(scheduleUseCase)
+	webhookHandler := handler.NewWebhookHandler(webhookUseCase)
 
 	authMiddleware := middleware.NewAuthMiddleware(userCacehRepo)
 
@@ -91,6 +121,7 @@ func Init(ctx context.Context) *chi.Mux {
 	}))
 
 	go hub.Run()
+	go retentionUseCase.RunPurger(ctx, config.RetentionPurgeInterval)
 
 	r.Route("/", func(r chi.Router) {
 		r.Group(func(r chi.Router) {
@@ -98,10 +129,33 @@ func Init(ctx context.Context) *chi.Mux {
 			r.Get("/ws", func(w http.ResponseWriter, r *http.Request) {
 				wsHandler.WebSocketConnection(w, r)
 			})
+			r.Get("/api/rooms/{id}/messages", messageHandler.ListRoomMessages)
+			r.Get("/api/rooms/{id}/reads", messageHandler.GetReadState)
+			r.Get("/api/rooms/{id}/pins", roomHandler.ListPins)
+			r.Get("/api/rooms/{id}/export", exportHandler.ExportRoom)
+			r.Put("/api/rooms/{id}/retention", roomHandler.UpdateRetention)
+			r.Post("/api/rooms/{id}/attachments", attachmentHandler.Upload)
+			r.Get("/api/attachments/{id}", attachmentHandler.Download)
+			r.Get("/api/attachments/{id}/thumbnail", attachmentHandler.DownloadThumbnail)
+			r.Post("/api/rooms/{id}/scheduled", scheduleHandler.ScheduleMessage)
+			r.Get("/api/scheduled", scheduleHandler.ListScheduledMessages)
+			r.Delete("/api/scheduled/{id}", scheduleHandler.CancelScheduledMessage)
+			r.Post("/api/rooms/{id}/hooks", webhookHandler.CreateIncomingWebhook)
+			r.Get("/api/rooms/{id}/hooks", webhookHandler.ListIncomingWebhooks)
+			r.Delete("/api/rooms/{id}/hooks/{hookID}", webhookHandler.DeleteIncomingWebhook)
+			r.Post("/api/rooms/{id}/outgoing-hooks", webhookHandler.CreateOutgoingWebhook)
+			r.Get("/api/rooms/{id}/outgoing-hooks", webhookHandler.ListOutgoingWebhooks)
+			r.Delete("/api/rooms/{id}/outgoing-hooks/{hookID}", webhookHandler.DeleteOutgoingWebhook)
+			r.Get("/api/rooms/{id}/outgoing-hooks/{hookID}/deliveries", webhookHandler.ListWebhookDeliveries)
+			r.Get("/api/messages/{id}/edits", messageHandler.ListMessageEdits)
+			r.Get("/api/messages/{id}/replies", messageHandler.GetThread)
+			r.Get("/api/search", searchHandler.SearchMessages)
+			r.Get("/api/dms", roomHandler.ListDirectConversations)
 		})
 	})
 
 	r.Get("/api/login", userHandler.Login)
+	r.Post("/hooks/{token}", webhookHandler.PostIncomingMessage)
 
 	return r
 }
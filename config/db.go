@@ -3,32 +3,51 @@ package config
 import (
 	"database/sql"
 	"log"
+
+	// Registers the "sqlite3" driver. Build with -tags sqlite_fts5 for message search.
+	_ "github.com/mattn/go-sqlite3"
 )
 
-// TODO: 以下ではroomとuserのみ永続化する。メッセージは永続化しない。
 func InitDB() *sql.DB {
+	return OpenDB("./chat.db")
+}
+
+// OpenDB opens the SQLite database at dataSourceName and brings its schema up to date.
+func OpenDB(dataSourceName string) *sql.DB {
 	// init db connection
-	db, err := sql.Open("sqlite3", "./chat.db")
+	db, err := sql.Open("sqlite3", dataSourceName)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Rooms were kept in a table named room before.
+	renameTable(db, "room", "rooms")
+
 	sqlStmt := `
-    CREATE TABLE IF NOT EXISTS room (
+    CREATE TABLE IF NOT EXISTS rooms (
         id VARCHAR(255) NOT NULL PRIMARY KEY,
         name VARCHAR(255) NOT NULL,
-        private TINYINT NULL
+        private TINYINT NULL,
+        retention_days INTEGER NOT NULL DEFAULT 0,
+        retention_messages INTEGER NOT NULL DEFAULT 0,
+        topic TEXT NOT NULL DEFAULT '',
+        direct TINYINT NOT NULL DEFAULT 0
     );
 	`
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
 		log.Printf("%q: %s\n", err, sqlStmt)
 	}
+	// Columns added since rooms were first stored.
+	addColumn(db, "rooms", "retention_days", "INTEGER NOT NULL DEFAULT 0")
+	addColumn(db, "rooms", "retention_messages", "INTEGER NOT NULL DEFAULT 0")
+	addColumn(db, "rooms", "topic", "TEXT NOT NULL DEFAULT ''")
+	addColumn(db, "rooms", "direct", "TINYINT NOT NULL DEFAULT 0")
 
 	sqlStmt = `
-	CREATE TABLE IF NOT EXISTS user (
+	CREATE TABLE IF NOT EXISTS users (
 		id VARCHAR(255) NOT NULL PRIMARY KEY,
-		name VARCHAR(255) NOT NULL
+		name VARCHAR(255) NOT NULL,
 		password VARCHAR(255) NOT NULL
 	);
 	`
@@ -37,5 +56,305 @@ func InitDB() *sql.DB {
 		log.Printf("%q: %s\n", err, sqlStmt)
 	}
 
+	// Messages were keyed by id alone before, which left the full-text index on the
+	// implicit rowid. The old table is set aside here and copied over below.
+	setAsideMessages := tableExists(db, "messages") && !columnExists(db, "messages", "seq")
+	if setAsideMessages {
+		sqlStmt = `
+	DROP TRIGGER IF EXISTS messages_fts_insert;
+	DROP TRIGGER IF EXISTS messages_fts_delete;
+	DROP TRIGGER IF EXISTS messages_fts_update;
+	DROP TABLE IF EXISTS messages_fts;
+	DROP INDEX IF EXISTS messages_room_id_idx;
+	DROP INDEX IF EXISTS messages_parent_id_idx;
+	ALTER TABLE messages RENAME TO messages_old;
+	`
+		_, err = db.Exec(sqlStmt)
+		if err != nil {
+			log.Fatalf("%q: %s\n", err, sqlStmt)
+		}
+	}
+
+	// seq gives the full-text index a rowid that stays stable across VACUUM.
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS messages (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		id VARCHAR(255) NOT NULL UNIQUE,
+		room_id VARCHAR(255) NOT NULL,
+		sender_id VARCHAR(255) NOT NULL,
+		content TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		edited_at DATETIME NULL,
+		deleted_at DATETIME NULL,
+		parent_id VARCHAR(255) NULL
+	);
+	CREATE INDEX IF NOT EXISTS messages_room_id_idx ON messages(room_id, id);
+	CREATE INDEX IF NOT EXISTS messages_parent_id_idx ON messages(parent_id, id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+	// Also finishes a copy that was interrupted before the old table was dropped.
+	rebuildSearchIndex := tableExists(db, "messages_old")
+	if rebuildSearchIndex {
+		sqlStmt = `
+	INSERT INTO messages(id, room_id, sender_id, content, created_at, edited_at, deleted_at, parent_id)
+		SELECT id, room_id, sender_id, content, created_at, edited_at, deleted_at, parent_id FROM messages_old
+		WHERE id NOT IN (SELECT id FROM messages) ORDER BY id;
+	DROP TABLE messages_old;
+	`
+		_, err = db.Exec(sqlStmt)
+		if err != nil {
+			log.Fatalf("%q: %s\n", err, sqlStmt)
+		}
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id VARCHAR(255) NOT NULL,
+		content TEXT NOT NULL,
+		edited_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS message_edits_message_id_idx ON message_edits(message_id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS room_moderators (
+		room_id VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		PRIMARY KEY (room_id, user_id)
+	);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS message_mentions (
+		message_id VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		PRIMARY KEY (message_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS message_mentions_user_id_idx ON message_mentions(user_id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS message_reactions (
+		message_id VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		emoji VARCHAR(64) NOT NULL,
+		PRIMARY KEY (message_id, user_id, emoji)
+	);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS read_cursors (
+		room_id VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		message_id VARCHAR(255) NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (room_id, user_id)
+	);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS room_members (
+		room_id VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		PRIMARY KEY (room_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS room_members_user_id_idx ON room_members(user_id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS room_pins (
+		room_id VARCHAR(255) NOT NULL,
+		message_id VARCHAR(255) NOT NULL,
+		pinned_by VARCHAR(255) NOT NULL,
+		pinned_at DATETIME NOT NULL,
+		PRIMARY KEY (room_id, message_id)
+	);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		room_id VARCHAR(255) NOT NULL,
+		message_id VARCHAR(255) NULL,
+		uploader_id VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		size INTEGER NOT NULL,
+		mime_type VARCHAR(255) NOT NULL,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS attachments_message_id_idx ON attachments(message_id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		room_id VARCHAR(255) NOT NULL,
+		sender_id VARCHAR(255) NOT NULL,
+		content TEXT NOT NULL,
+		parent_id VARCHAR(255) NULL,
+		send_at DATETIME NOT NULL,
+		message_id VARCHAR(255) NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS scheduled_messages_send_at_idx ON scheduled_messages(send_at);
+	CREATE INDEX IF NOT EXISTS scheduled_messages_sender_id_idx ON scheduled_messages(sender_id, send_at);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS incoming_webhooks (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		room_id VARCHAR(255) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS incoming_webhooks_room_id_idx ON incoming_webhooks(room_id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	sqlStmt = `
+	CREATE TABLE IF NOT EXISTS outgoing_webhooks (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		room_id VARCHAR(255) NOT NULL,
+		url TEXT NOT NULL,
+		events VARCHAR(255) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS outgoing_webhooks_room_id_idx ON outgoing_webhooks(room_id);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		webhook_id VARCHAR(255) NOT NULL,
+		event_id VARCHAR(255) NOT NULL,
+		event VARCHAR(255) NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		succeeded TINYINT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries(webhook_id, id);
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+
+	// Full-text index over message content, kept in sync with messages by triggers.
+	// Requires a SQLite build with FTS5, i.e. the sqlite_fts5 build tag of go-sqlite3.
+	sqlStmt = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(content, content='messages', content_rowid='seq');
+	CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content) VALUES (new.seq, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.seq, old.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.seq, old.content);
+		INSERT INTO messages_fts(rowid, content) VALUES (new.seq, new.content);
+	END;
+	`
+	_, err = db.Exec(sqlStmt)
+	if err != nil {
+		log.Fatalf("%q: %s\nBuild with -tags sqlite_fts5 to enable FTS5.", err, sqlStmt)
+	}
+	if rebuildSearchIndex {
+		sqlStmt = "INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')"
+		if _, err = db.Exec(sqlStmt); err != nil {
+			log.Printf("%q: %s\n", err, sqlStmt)
+		}
+	}
+
 	return db
 }
+
+// renameTable renames a table of an older schema, unless it is gone or the new name is taken.
+func renameTable(db *sql.DB, from string, to string) {
+	if !tableExists(db, from) || tableExists(db, to) {
+		return
+	}
+	sqlStmt := "ALTER TABLE " + from + " RENAME TO " + to
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+}
+
+// addColumn adds a column to a table created by an older schema, unless it is there already.
+func addColumn(db *sql.DB, table string, column string, definition string) {
+	if columnExists(db, table, column) {
+		return
+	}
+	sqlStmt := "ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition
+	if _, err := db.Exec(sqlStmt); err != nil {
+		log.Printf("%q: %s\n", err, sqlStmt)
+	}
+}
+
+func columnExists(db *sql.DB, table string, column string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return count > 0
+}
+
+func tableExists(db *sql.DB, name string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return count > 0
+}
@@ -1,5 +1,78 @@
 package config
 
+import "time"
+
 type ContextKey string
 
 const ContextUserIDKey ContextKey = "userID"
+
+// Interval between purges of messages past their room's retention policy.
+const RetentionPurgeInterval = time.Hour
+
+// Directory of the local-disk blob store for attachments.
+const AttachmentDir = "./attachments"
+
+const (
+	// Max size in bytes of an uploaded attachment.
+	MaxAttachmentSize = 25 << 20
+
+	// Max number of attachments referenced by a single message.
+	MaxAttachmentsPerMessage = 10
+
+	// Uploads not sent in a message within this window are purged.
+	UnsentAttachmentTTL = 24 * time.Hour
+)
+
+const (
+	// Thumbnails fit within a square of this many pixels per side.
+	ThumbnailSize = 320
+
+	// Images with more pixels than this are not decoded for a thumbnail.
+	MaxThumbnailSourcePixels = 40_000_000
+
+	// Path of the thumbnail of an attachment, formatted with the attachment ID.
+	AttachmentThumbnailPath = "/api/attachments/%s/thumbnail"
+)
+
+const (
+	// How often each node looks for scheduled messages that are due.
+	SchedulerInterval = time.Second
+
+	// Max number of due scheduled messages sent per scheduler run.
+	SchedulerBatchSize = 100
+
+	// A node that claimed a scheduled message has this long to send it before another node retries.
+	ScheduleLeaseTTL = time.Minute
+
+	// Max time ahead a message can be scheduled.
+	MaxScheduleAhead = 365 * 24 * time.Hour
+)
+
+const (
+	// Max size in bytes of a request body posted to an incoming webhook.
+	MaxWebhookPayloadSize = 64 << 10
+
+	// Max length in bytes of a webhook name.
+	MaxWebhookNameSize = 64
+)
+
+// Events of a room delivered to its outgoing webhooks.
+const (
+	WebhookEventMessage = "message"
+	WebhookEventJoin    = "join"
+	WebhookEventLeave   = "leave"
+)
+
+const (
+	// Max number of attempts to deliver an event to an outgoing webhook.
+	WebhookMaxAttempts = 5
+
+	// Wait before the first retry of a failed delivery; it doubles on every retry.
+	WebhookInitialBackoff = time.Second
+
+	// Max time a webhook receiver has to respond.
+	WebhookTimeout = 10 * time.Second
+
+	// Number of recent delivery attempts returned by the delivery log.
+	WebhookDeliveryLogSize = 100
+)
@@ -3,13 +3,30 @@ package config
 import "time"
 
 const (
-	SendMessageAction     = "send_message"
-	JoinRoomAction        = "join_room"
-	LeaveRoomAction       = "leave_room"
-	UserJoinedAction      = "user_joined"
-	UserLeftAction        = "user_left"
-	JoinRoomPrivateAction = "join_room_private"
-	RoomJoinedAction      = "room-joined"
+	SendMessageAction      = "send_message"
+	JoinRoomAction         = "join_room"
+	LeaveRoomAction        = "leave_room"
+	UserJoinedAction       = "user_joined"
+	UserLeftAction         = "user_left"
+	JoinRoomPrivateAction  = "join_room_private"
+	RoomJoinedAction       = "room-joined"
+	EditMessageAction      = "edit_message"
+	DeleteMessageAction    = "delete_message"
+	AddReactionAction      = "add_reaction"
+	RemoveReactionAction   = "remove_reaction"
+	MarkReadAction         = "mark_read"
+	TypingAction           = "typing"
+	StopTypingAction       = "stop_typing"
+	AckAction              = "ack"
+	MentionAction          = "mention"
+	PinMessageAction       = "pin_message"
+	UnpinMessageAction     = "unpin_message"
+	ScheduleMessageAction  = "schedule_message"
+	TopicChangedAction     = "topic_changed"
+	CommandReplyAction     = "command_reply"
+	DirectMessageAction    = "direct_message"
+	HistoryTruncatedAction = "history_truncated"
+	ErrorAction            = "error"
 )
 
 const (
@@ -24,9 +41,48 @@ const (
 
 	// Max message size allowed from peer.
 	MaxMessageSize = 10000
+
+	// Max number of missed messages replayed to a client that resumes; only the latest are
+	// replayed, after a history_truncated message, when more were missed.
+	MaxResumeMessages = 500
+
+	// Max length in bytes of a reaction emoji.
+	MaxReactionSize = 64
+
+	// Min interval between typing events fanned out for the same user.
+	TypingThrottle = 3 * time.Second
+
+	// A user is considered to have stopped typing after this long without a typing event.
+	TypingTimeout = 6 * time.Second
+
+	// Retries of send_message with the same nonce within this window are not stored again.
+	NonceWindow = 5 * time.Minute
+
+	// Max length of a client nonce.
+	MaxNonceSize = 64
+
+	// Max number of @name tokens resolved in a single message.
+	MaxMentions = 20
+
+	// Max length in bytes of a room topic set with /topic.
+	MaxTopicSize = 250
+
+	// Max length in bytes of a user name set with /nick.
+	MaxUserNameSize = 32
 )
 
 const WelcomeMessage = "%s joined the room"
 const GoodbyeMessage = "%s left the room"
 
+const ErrMessageNotFound = "message not found"
+const ErrEmptyMessage = "message is empty"
+const ErrNotMessageOwner = "only the author can change this message"
+const ErrInvalidReaction = "invalid reaction"
+const ErrInvalidNonce = "invalid nonce"
+const ErrInvalidAttachment = "invalid attachment"
+const ErrInvalidSchedule = "invalid send time"
+const ErrUnknownCommand = "unknown command, try /help"
+const ErrUserNotFound = "user not found"
+const ErrNotMessageModerator = "only the author or a room moderator can delete this message"
+
 const PubSubGeneralChannel = "general"
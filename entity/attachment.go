@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// Attachment is a file uploaded to a room and referenced by a message.
+type Attachment struct {
+	ID         string `json:"id"`
+	RoomID     string `json:"room_id"`
+	MessageID  string `json:"message_id,omitempty"`
+	UploaderID string `json:"uploader_id"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	MIMEType   string `json:"mime_type"`
+	// Width, Height and ThumbnailURL are only set for images.
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,7 @@
+package entity
+
+// ExportedMessage is a message of a room export with the name of its sender resolved.
+type ExportedMessage struct {
+	*Message
+	SenderName string `json:"sender_name"`
+}
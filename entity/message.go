@@ -3,13 +3,48 @@ package entity
 import (
 	"encoding/json"
 	"log"
+	"time"
 )
 
 type Message struct {
-	Action   string `json:"action"`
-	Content  string `json:"content"`
+	// ID is assigned by the server and sorts in the order messages were accepted.
+	ID      string `json:"id,omitempty"`
+	Action  string `json:"action"`
+	Content string `json:"content"`
+	// HTML is the content rendered from Markdown by the server and safe to insert into a page.
+	HTML     string `json:"html,omitempty"`
 	TargetID string `json:"target"`
 	SenderID string `json:"sender"`
+	// ParentID makes the message a reply in the thread of the referenced message.
+	ParentID string `json:"parent_id,omitempty"`
+	// ReplyCount is the number of replies in the message's thread, filled in from storage.
+	ReplyCount int `json:"reply_count,omitempty"`
+	// Attachments are files uploaded to the room beforehand. Clients reference them by ID;
+	// the server fills in the rest.
+	Attachments []*Attachment `json:"attachments,omitempty"`
+	// Mentions are the IDs of the users mentioned with @name in the content.
+	Mentions []string `json:"mentions,omitempty"`
+	// Reactions is the number of users per emoji that reacted to the message.
+	Reactions map[string]int `json:"reactions,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	// DeletedAt is set once a message is redacted; its content is no longer kept.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// LastMessageID is sent by a reconnecting client on join_room so that the
+	// room can replay the messages it missed, up to config.MaxResumeMessages.
+	LastMessageID string `json:"last_message_id,omitempty"`
+	// Nonce is chosen by the client on send_message to make retries idempotent.
+	Nonce string `json:"nonce,omitempty"`
+	// SendAt is the time a schedule_message is to be sent. The server's reply carries
+	// the ID of the schedule in ID.
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+// MessageEdit is a previous version of an edited message.
+type MessageEdit struct {
+	MessageID string    `json:"message_id"`
+	Content   string    `json:"content"`
+	EditedAt  time.Time `json:"edited_at"`
 }
 
 func (message *Message) Encode() []byte {
@@ -0,0 +1,39 @@
+package entity
+
+import "time"
+
+// OutgoingWebhook receives the events of a room as signed JSON. The secret signs the
+// payloads and is shown once when the webhook is created.
+type OutgoingWebhook struct {
+	ID     string   `json:"id"`
+	RoomID string   `json:"room_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"-"`
+	// CreatedBy is the moderator who registered the webhook.
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the JSON body posted to an outgoing webhook.
+type WebhookEvent struct {
+	// ID is the same across the retries of a delivery so that receivers can dedupe.
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	RoomID    string    `json:"room_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to an outgoing webhook.
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	WebhookID  string    `json:"webhook_id"`
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Succeeded  bool      `json:"succeeded"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,7 @@
+package entity
+
+type Reaction struct {
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
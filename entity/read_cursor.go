@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// ReadCursor is the last message of a room that a user has read.
+type ReadCursor struct {
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	MessageID string    `json:"message_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -1,7 +1,66 @@
 package entity
 
+import (
+	"strings"
+	"time"
+)
+
+// Names of direct message rooms start with DirectRoomPrefix, which other rooms may not use.
+const DirectRoomPrefix = "dm:"
+
 type Room struct {
 	ID      string `json:"id"`
 	Name    string `json:"name"`
 	Private bool   `json:"private"`
+	// RetentionDays and RetentionMessages limit how long the room's messages are kept.
+	// Zero keeps messages forever.
+	RetentionDays     int    `json:"retention_days"`
+	RetentionMessages int    `json:"retention_messages"`
+	Topic             string `json:"topic,omitempty"`
+	// Direct rooms hold the direct messages between two users.
+	Direct bool `json:"direct,omitempty"`
+}
+
+// DirectRoomName is the name of the direct message room of two users, whichever of them opens it.
+func DirectRoomName(userID string, peerID string) string {
+	if peerID < userID {
+		userID, peerID = peerID, userID
+	}
+	return DirectRoomPrefix + userID + ":" + peerID
+}
+
+// DirectRoomPeer returns the other user of the direct message room with the name, or ""
+// if userID is not one of its users.
+func DirectRoomPeer(roomName string, userID string) string {
+	pair, ok := strings.CutPrefix(roomName, DirectRoomPrefix)
+	if !ok {
+		return ""
+	}
+	first, second, _ := strings.Cut(pair, ":")
+	switch userID {
+	case first:
+		return second
+	case second:
+		return first
+	}
+	return ""
+}
+
+// DirectConversation is a direct message room as seen by one of its users.
+type DirectConversation struct {
+	RoomID string `json:"room_id"`
+	PeerID string `json:"peer_id"`
+	// PeerName is empty when the other user no longer exists.
+	PeerName string `json:"peer_name"`
+	// LastMessage is the most recent message of the conversation, if any.
+	LastMessage *Message `json:"last_message,omitempty"`
+}
+
+// Pin keeps a message of the room visible to its members.
+type Pin struct {
+	RoomID    string    `json:"room_id"`
+	MessageID string    `json:"message_id"`
+	PinnedBy  string    `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+	Message   *Message  `json:"message,omitempty"`
 }
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// ScheduledMessage is a message to be sent to a room at SendAt.
+type ScheduledMessage struct {
+	ID       string    `json:"id"`
+	RoomID   string    `json:"room_id"`
+	SenderID string    `json:"sender_id"`
+	Content  string    `json:"content"`
+	ParentID string    `json:"parent_id,omitempty"`
+	SendAt   time.Time `json:"send_at"`
+	// MessageID is assigned once a node starts sending the message. A schedule with a
+	// message ID can no longer be cancelled.
+	MessageID string    `json:"message_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// MessageSearch is a parsed message search restricted to a set of rooms.
+type MessageSearch struct {
+	// Match is an FTS5 query over message content. Empty matches every message.
+	Match    string
+	RoomIDs  []string
+	SenderID string
+	// After and Before bound the creation time of messages when they are not zero.
+	After  time.Time
+	Before time.Time
+}
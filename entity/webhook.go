@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// IncomingWebhook lets an external system post messages into a room. Only a hash of its
+// token is kept, so the token is shown once when the webhook is created.
+type IncomingWebhook struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"room_id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"-"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+// Room for the multipart headers around the file part.
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler interface {
+	Upload(w http.ResponseWriter, r *http.Request)
+	Download(w http.ResponseWriter, r *http.Request)
+	DownloadThumbnail(w http.ResponseWriter, r *http.Request)
+}
+
+type attachmentHandler struct {
+	auc usecase.AttachmentUseCase
+}
+
+func NewAttachmentHandler(auc usecase.AttachmentUseCase) AttachmentHandler {
+	return &attachmentHandler{
+		auc: auc,
+	}
+}
+
+// Upload expects a multipart form with the file in the "file" field.
+func (ah *attachmentHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, config.MaxAttachmentSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Invalid upload request", http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			http.Error(w, "Missing file field", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Invalid upload request", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		attachment, err := ah.auc.Upload(ctx, userID, roomID, part.FileName(), part)
+		part.Close()
+		if errors.Is(err, usecase.ErrNotRoomMember) {
+			http.Error(w, "Not a member of the room", http.StatusForbidden)
+			return
+		} else if errors.Is(err, usecase.ErrAttachmentTooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to upload file", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err = json.NewEncoder(w).Encode(attachment); err != nil {
+			log.Printf("Failed to encode response: %v", err)
+		}
+		return
+	}
+}
+
+func (ah *attachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attachmentID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	attachment, content, err := ah.auc.Open(ctx, userID, attachmentID)
+	if errors.Is(err, usecase.ErrAttachmentNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.MIMEType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err = io.Copy(w, content); err != nil {
+		log.Printf("Failed to write attachment: %v", err)
+	}
+}
+
+func (ah *attachmentHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attachmentID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	content, mimeType, err := ah.auc.OpenThumbnail(ctx, userID, attachmentID)
+	if errors.Is(err, usecase.ErrAttachmentNotFound) {
+		http.Error(w, "Thumbnail not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to open thumbnail", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err = io.Copy(w, content); err != nil {
+		log.Printf("Failed to write thumbnail: %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+// Flush the response after this many messages so that large exports reach the client steadily.
+const exportFlushInterval = 100
+
+type ExportHandler interface {
+	ExportRoom(w http.ResponseWriter, r *http.Request)
+}
+
+type exportHandler struct {
+	euc usecase.ExportUseCase
+}
+
+func NewExportHandler(euc usecase.ExportUseCase) ExportHandler {
+	return &exportHandler{
+		euc: euc,
+	}
+}
+
+// ExportRoom streams the history of a room as json (one document), ndjson (one message
+// per line) or html (a standalone transcript). from and to are RFC 3339 times or dates.
+func (eh *exportHandler) ExportRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := parseExportTime(query.Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from time", http.StatusBadRequest)
+		return
+	}
+	to, err := parseExportTime(query.Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to time", http.StatusBadRequest)
+		return
+	}
+
+	t := &transcript{w: w}
+	var tw usecase.TranscriptWriter
+	switch query.Get("format") {
+	case "", "json":
+		tw = &jsonTranscript{t}
+	case "ndjson":
+		tw = &ndjsonTranscript{transcript: t}
+	case "html":
+		tw = &htmlTranscript{t}
+	default:
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	err = eh.euc.ExportRoom(ctx, userID, roomID, from, to, tw)
+	if errors.Is(err, usecase.ErrInvalidExportRange) {
+		http.Error(w, "Invalid time range", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		// Once the header is out the status is sent; the truncated body is all that is left.
+		log.Printf("Failed to export room: %v", err)
+		if !t.begun {
+			http.Error(w, "Failed to export room", http.StatusInternalServerError)
+		}
+	}
+}
+
+// An empty value leaves the bound open.
+func parseExportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// transcript holds the response state shared by the export formats.
+type transcript struct {
+	w       http.ResponseWriter
+	written int
+	begun   bool
+}
+
+func (t *transcript) begin(room *entity.Room, contentType string, ext string) {
+	t.begun = true
+	filename := fmt.Sprintf("%s-transcript.%s", room.Name, ext)
+	t.w.Header().Set("Content-Type", contentType)
+	t.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	t.w.Header().Set("X-Content-Type-Options", "nosniff")
+	t.w.WriteHeader(http.StatusOK)
+}
+
+func (t *transcript) wrote() {
+	t.written++
+	if t.written%exportFlushInterval == 0 {
+		if f, ok := t.w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+type jsonTranscript struct {
+	*transcript
+}
+
+type exportHeader struct {
+	Room *entity.Room `json:"room"`
+	From *time.Time   `json:"from,omitempty"`
+	To   time.Time    `json:"to"`
+}
+
+// The document is {"room":...,"from":...,"to":...,"messages":[...]}, written piece by piece.
+func (jt *jsonTranscript) WriteHeader(room *entity.Room, from time.Time, to time.Time) error {
+	jt.begin(room, "application/json", "json")
+	header := exportHeader{Room: room, To: to}
+	if !from.IsZero() {
+		header.From = &from
+	}
+	b, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to append the messages array.
+	if _, err = jt.w.Write(b[:len(b)-1]); err != nil {
+		return err
+	}
+	_, err = io.WriteString(jt.w, `,"messages":[`)
+	return err
+}
+
+func (jt *jsonTranscript) WriteMessage(message *entity.ExportedMessage) error {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if jt.written > 0 {
+		if _, err = io.WriteString(jt.w, ","); err != nil {
+			return err
+		}
+	}
+	if _, err = jt.w.Write(b); err != nil {
+		return err
+	}
+	jt.wrote()
+	return nil
+}
+
+func (jt *jsonTranscript) WriteFooter() error {
+	_, err := io.WriteString(jt.w, "]}\n")
+	return err
+}
+
+type ndjsonTranscript struct {
+	*transcript
+	enc *json.Encoder
+}
+
+func (nt *ndjsonTranscript) WriteHeader(room *entity.Room, _ time.Time, _ time.Time) error {
+	nt.begin(room, "application/x-ndjson", "ndjson")
+	nt.enc = json.NewEncoder(nt.w)
+	return nil
+}
+
+func (nt *ndjsonTranscript) WriteMessage(message *entity.ExportedMessage) error {
+	if err := nt.enc.Encode(message); err != nil {
+		return err
+	}
+	nt.wrote()
+	return nil
+}
+
+func (nt *ndjsonTranscript) WriteFooter() error {
+	return nil
+}
+
+type htmlTranscript struct {
+	*transcript
+}
+
+var transcriptHeaderTemplate = template.Must(template.New("header").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>#{{.Room.Name}} transcript</title>
+<style>
+body{font:15px/1.5 -apple-system,"Segoe UI",Helvetica,Arial,sans-serif;color:#1d1c1d;max-width:860px;margin:0 auto;padding:24px}
+header{border-bottom:1px solid #ddd;margin-bottom:16px}
+h1{font-size:22px;margin:0 0 4px}
+.meta{color:#616061;font-size:13px}
+.msg{padding:6px 0;border-bottom:1px solid #f2f2f2}
+.msg.reply{margin-left:32px}
+.sender{font-weight:700}
+time{color:#616061;font-size:12px;margin-left:6px}
+.tag{color:#616061;font-size:12px;margin-left:6px;font-style:italic}
+.body p{margin:2px 0}
+.body pre{background:#f6f6f6;border:1px solid #e5e5e5;border-radius:4px;padding:8px;overflow-x:auto}
+.body code{background:#f6f6f6;border-radius:3px;padding:0 3px}
+.deleted{color:#999;font-style:italic}
+.attachments,.reactions{font-size:13px;color:#616061;margin:2px 0;padding:0;list-style:none}
+.reactions li{display:inline-block;border:1px solid #ddd;border-radius:10px;padding:0 6px;margin-right:4px}
+</style>
+</head>
+<body>
+<header>
+<h1>#{{.Room.Name}}</h1>
+{{if .Room.Topic}}<div class="meta">{{.Room.Topic}}</div>{{end}}
+<div class="meta">{{if .From}}From {{.From}} to{{else}}Up to{{end}} {{.To}}</div>
+</header>
+<main>
+`))
+
+var transcriptMessageTemplate = template.Must(template.New("message").Parse(`<div class="msg{{if .ParentID}} reply{{end}}" id="m-{{.ID}}">
+<span class="sender">{{.SenderName}}</span><time datetime="{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</time>
+{{- if .ParentID}}<a class="tag" href="#m-{{.ParentID}}">reply</a>{{end}}
+{{- if .EditedAt}}<span class="tag">edited</span>{{end}}
+{{if .DeletedAt}}<div class="body deleted">This message was deleted.</div>
+{{else}}<div class="body">{{.Body}}</div>
+{{end}}
+{{- if .Attachments}}<ul class="attachments">{{range .Attachments}}<li>📎 {{.Name}} ({{.Size}} bytes)</li>{{end}}</ul>
+{{end}}
+{{- if .Reactions}}<ul class="reactions">{{range $emoji, $count := .Reactions}}<li>{{$emoji}} {{$count}}</li>{{end}}</ul>
+{{end}}
+</div>
+`))
+
+type transcriptHeader struct {
+	Room *entity.Room
+	From string
+	To   string
+}
+
+type transcriptMessage struct {
+	*entity.ExportedMessage
+	// Body is the content rendered and sanitized by the server.
+	Body template.HTML
+}
+
+const transcriptTimeLayout = "2006-01-02 15:04 MST"
+
+func (ht *htmlTranscript) WriteHeader(room *entity.Room, from time.Time, to time.Time) error {
+	ht.begin(room, "text/html; charset=utf-8", "html")
+	header := transcriptHeader{Room: room, To: to.UTC().Format(transcriptTimeLayout)}
+	if !from.IsZero() {
+		header.From = from.UTC().Format(transcriptTimeLayout)
+	}
+	return transcriptHeaderTemplate.Execute(ht.w, header)
+}
+
+func (ht *htmlTranscript) WriteMessage(message *entity.ExportedMessage) error {
+	err := transcriptMessageTemplate.Execute(ht.w, transcriptMessage{
+		ExportedMessage: message,
+		Body:            template.HTML(message.HTML), //nolint:gosec // rendered by internal/markdown, which escapes its input
+	})
+	if err != nil {
+		return err
+	}
+	ht.wrote()
+	return nil
+}
+
+func (ht *htmlTranscript) WriteFooter() error {
+	_, err := io.WriteString(ht.w, "</main>\n</body>\n</html>\n")
+	return err
+}
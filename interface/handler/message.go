@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+type MessageHandler interface {
+	ListRoomMessages(w http.ResponseWriter, r *http.Request)
+	ListMessageEdits(w http.ResponseWriter, r *http.Request)
+	GetThread(w http.ResponseWriter, r *http.Request)
+	GetReadState(w http.ResponseWriter, r *http.Request)
+}
+
+type messageHandler struct {
+	muc usecase.MessageUseCase
+}
+
+func NewMessageHandler(muc usecase.MessageUseCase) MessageHandler {
+	return &messageHandler{
+		muc: muc,
+	}
+}
+
+type ListRoomMessagesResponse struct {
+	Messages   []*entity.Message `json:"messages"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+type GetThreadResponse struct {
+	Parent  *entity.Message   `json:"parent"`
+	Replies []*entity.Message `json:"replies"`
+}
+
+type GetReadStateResponse struct {
+	Cursors     []*entity.ReadCursor `json:"cursors"`
+	UnreadCount int                  `json:"unread_count"`
+}
+
+type ListMessageEditsResponse struct {
+	Edits []*entity.MessageEdit `json:"edits"`
+}
+
+func (mh *messageHandler) ListRoomMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	messages, next, err := mh.muc.ListRoomMessages(ctx, userID, roomID, r.URL.Query().Get("before"), limit)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to list messages", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []*entity.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListRoomMessagesResponse{Messages: messages, NextCursor: next}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (mh *messageHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	messageID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	parent, replies, err := mh.muc.GetThread(ctx, userID, messageID, r.URL.Query().Get("after"), limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+		return
+	}
+	if replies == nil {
+		replies = []*entity.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(GetThreadResponse{Parent: parent, Replies: replies}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (mh *messageHandler) GetReadState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	cursors, unread, err := mh.muc.GetReadState(ctx, roomID, userID)
+	if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to get read state", http.StatusInternalServerError)
+		return
+	}
+	if cursors == nil {
+		cursors = []*entity.ReadCursor{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(GetReadStateResponse{Cursors: cursors, UnreadCount: unread}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (mh *messageHandler) ListMessageEdits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	messageID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	edits, err := mh.muc.ListMessageEdits(ctx, userID, messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to list message edits", http.StatusInternalServerError)
+		return
+	}
+	if edits == nil {
+		edits = []*entity.MessageEdit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListMessageEditsResponse{Edits: edits}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// parseLimit reads the optional limit query parameter, replying with 400 when it is malformed.
+func parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return 0, false
+	}
+	return limit, true
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+type RoomHandler interface {
+	ListPins(w http.ResponseWriter, r *http.Request)
+	ListDirectConversations(w http.ResponseWriter, r *http.Request)
+	UpdateRetention(w http.ResponseWriter, r *http.Request)
+}
+
+type roomHandler struct {
+	ruc usecase.RoomUseCase
+}
+
+func NewRoomHandler(ruc usecase.RoomUseCase) RoomHandler {
+	return &roomHandler{
+		ruc: ruc,
+	}
+}
+
+type UpdateRetentionRequest struct {
+	RetentionDays     int `json:"retention_days"`
+	RetentionMessages int `json:"retention_messages"`
+}
+
+type ListPinsResponse struct {
+	Pins []*entity.Pin `json:"pins"`
+}
+
+func (rh *roomHandler) ListPins(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	pins, err := rh.ruc.ListPins(ctx, userID, roomID)
+	if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to list pins", http.StatusInternalServerError)
+		return
+	}
+	if pins == nil {
+		pins = []*entity.Pin{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListPinsResponse{Pins: pins}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (rh *roomHandler) UpdateRetention(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	var requestBody UpdateRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid retention request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	err := rh.ruc.UpdateRetention(ctx, userID, roomID, requestBody.RetentionDays, requestBody.RetentionMessages)
+	if errors.Is(err, usecase.ErrInvalidRetention) {
+		http.Error(w, "Invalid retention request", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can change retention", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update retention", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ListDirectConversationsResponse struct {
+	Conversations []*entity.DirectConversation `json:"conversations"`
+}
+
+func (rh *roomHandler) ListDirectConversations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	conversations, err := rh.ruc.ListDirectConversations(ctx, userID)
+	if err != nil {
+		http.Error(w, "Failed to list direct messages", http.StatusInternalServerError)
+		return
+	}
+	if conversations == nil {
+		conversations = []*entity.DirectConversation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListDirectConversationsResponse{Conversations: conversations}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+type ScheduleHandler interface {
+	ScheduleMessage(w http.ResponseWriter, r *http.Request)
+	ListScheduledMessages(w http.ResponseWriter, r *http.Request)
+	CancelScheduledMessage(w http.ResponseWriter, r *http.Request)
+}
+
+type scheduleHandler struct {
+	suc usecase.ScheduleUseCase
+}
+
+func NewScheduleHandler(suc usecase.ScheduleUseCase) ScheduleHandler {
+	return &scheduleHandler{
+		suc: suc,
+	}
+}
+
+type ScheduleMessageRequest struct {
+	Content  string    `json:"content"`
+	ParentID string    `json:"parent_id"`
+	SendAt   time.Time `json:"send_at"`
+}
+
+type ListScheduledMessagesResponse struct {
+	ScheduledMessages []*entity.ScheduledMessage `json:"scheduled_messages"`
+}
+
+func (sh *scheduleHandler) ScheduleMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	var requestBody ScheduleMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid schedule request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	scheduled, err := sh.suc.ScheduleMessage(ctx, userID, roomID, requestBody.Content, requestBody.ParentID, requestBody.SendAt)
+	if errors.Is(err, usecase.ErrInvalidSchedule) {
+		http.Error(w, "Invalid send time", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrInvalidScheduleContent) {
+		http.Error(w, "Invalid message", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrParentNotFound) {
+		http.Error(w, "Parent message not found", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomMember) {
+		http.Error(w, "Not a member of the room", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to schedule message", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(scheduled); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (sh *scheduleHandler) ListScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	list, err := sh.suc.ListScheduledMessages(ctx, userID)
+	if err != nil {
+		http.Error(w, "Failed to list scheduled messages", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []*entity.ScheduledMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListScheduledMessagesResponse{ScheduledMessages: list}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (sh *scheduleHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	err := sh.suc.CancelScheduledMessage(ctx, userID, id)
+	if errors.Is(err, usecase.ErrScheduleNotFound) {
+		http.Error(w, "Scheduled message not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to cancel scheduled message", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
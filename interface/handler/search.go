@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+type SearchHandler interface {
+	SearchMessages(w http.ResponseWriter, r *http.Request)
+}
+
+type searchHandler struct {
+	suc usecase.SearchUseCase
+}
+
+func NewSearchHandler(suc usecase.SearchUseCase) SearchHandler {
+	return &searchHandler{
+		suc: suc,
+	}
+}
+
+type SearchMessagesResponse struct {
+	Messages []*entity.Message `json:"messages"`
+}
+
+func (sh *searchHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	limit, ok := parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := sh.suc.SearchMessages(ctx, userID, r.URL.Query().Get("q"), limit)
+	if errors.Is(err, usecase.ErrInvalidSearchQuery) {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to search messages", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []*entity.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(SearchMessagesResponse{Messages: messages}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
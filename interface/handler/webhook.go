@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/usecase"
+)
+
+type WebhookHandler interface {
+	CreateIncomingWebhook(w http.ResponseWriter, r *http.Request)
+	ListIncomingWebhooks(w http.ResponseWriter, r *http.Request)
+	DeleteIncomingWebhook(w http.ResponseWriter, r *http.Request)
+	PostIncomingMessage(w http.ResponseWriter, r *http.Request)
+	CreateOutgoingWebhook(w http.ResponseWriter, r *http.Request)
+	ListOutgoingWebhooks(w http.ResponseWriter, r *http.Request)
+	DeleteOutgoingWebhook(w http.ResponseWriter, r *http.Request)
+	ListWebhookDeliveries(w http.ResponseWriter, r *http.Request)
+}
+
+type webhookHandler struct {
+	wuc usecase.WebhookUseCase
+}
+
+func NewWebhookHandler(wuc usecase.WebhookUseCase) WebhookHandler {
+	return &webhookHandler{
+		wuc: wuc,
+	}
+}
+
+type CreateIncomingWebhookRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateIncomingWebhookResponse struct {
+	Webhook *entity.IncomingWebhook `json:"webhook"`
+	// URL is the path to post messages to. It embeds the token and is only returned here.
+	URL string `json:"url"`
+}
+
+type ListIncomingWebhooksResponse struct {
+	Webhooks []*entity.IncomingWebhook `json:"webhooks"`
+}
+
+type CreateOutgoingWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type CreateOutgoingWebhookResponse struct {
+	Webhook *entity.OutgoingWebhook `json:"webhook"`
+	// Secret signs the deliveries to the webhook. It is only returned here.
+	Secret string `json:"secret"`
+}
+
+type ListOutgoingWebhooksResponse struct {
+	Webhooks []*entity.OutgoingWebhook `json:"webhooks"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []*entity.WebhookDelivery `json:"deliveries"`
+}
+
+// PostIncomingMessageRequest takes the text of the message, which is rendered as Markdown.
+type PostIncomingMessageRequest struct {
+	Text string `json:"text"`
+}
+
+func (wh *webhookHandler) CreateIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	var requestBody CreateIncomingWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid webhook request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	webhook, token, err := wh.wuc.CreateIncomingWebhook(ctx, userID, roomID, requestBody.Name)
+	if errors.Is(err, usecase.ErrInvalidWebhook) {
+		http.Error(w, "Invalid webhook name", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(CreateIncomingWebhookResponse{Webhook: webhook, URL: "/hooks/" + token}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (wh *webhookHandler) ListIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := wh.wuc.ListIncomingWebhooks(ctx, userID, roomID)
+	if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+	if webhooks == nil {
+		webhooks = []*entity.IncomingWebhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListIncomingWebhooksResponse{Webhooks: webhooks}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (wh *webhookHandler) DeleteIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	webhookID := chi.URLParam(r, "hookID")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	err := wh.wuc.DeleteIncomingWebhook(ctx, userID, roomID, webhookID)
+	if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if errors.Is(err, usecase.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostIncomingMessage is called by external systems; the token in the path authenticates them.
+func (wh *webhookHandler) PostIncomingMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := chi.URLParam(r, "token")
+
+	r.Body = http.MaxBytesReader(w, r.Body, config.MaxWebhookPayloadSize)
+	var requestBody PostIncomingMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	message, err := wh.wuc.PostIncomingMessage(ctx, token, requestBody.Text)
+	if errors.Is(err, usecase.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, usecase.ErrInvalidWebhookPost) {
+		http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to post message", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(message); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (wh *webhookHandler) CreateOutgoingWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	var requestBody CreateOutgoingWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid webhook request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	webhook, secret, err := wh.wuc.CreateOutgoingWebhook(ctx, userID, roomID, requestBody.URL, requestBody.Events)
+	if errors.Is(err, usecase.ErrInvalidWebhookURL) {
+		http.Error(w, "Invalid webhook URL or events", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(CreateOutgoingWebhookResponse{Webhook: webhook, Secret: secret}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (wh *webhookHandler) ListOutgoingWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	webhooks, err := wh.wuc.ListOutgoingWebhooks(ctx, userID, roomID)
+	if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+	if webhooks == nil {
+		webhooks = []*entity.OutgoingWebhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListOutgoingWebhooksResponse{Webhooks: webhooks}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (wh *webhookHandler) DeleteOutgoingWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	webhookID := chi.URLParam(r, "hookID")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	err := wh.wuc.DeleteOutgoingWebhook(ctx, userID, roomID, webhookID)
+	if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if errors.Is(err, usecase.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *webhookHandler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	roomID := chi.URLParam(r, "id")
+	webhookID := chi.URLParam(r, "hookID")
+	userID, ok := ctx.Value(config.ContextUserIDKey).(string)
+	if !ok {
+		http.Error(w, "Failed to get user from context", http.StatusUnauthorized)
+		return
+	}
+
+	deliveries, err := wh.wuc.ListWebhookDeliveries(ctx, userID, roomID, webhookID)
+	if errors.Is(err, usecase.ErrNotRoomModerator) {
+		http.Error(w, "Only room moderators can manage webhooks", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*entity.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ListWebhookDeliveriesResponse{Deliveries: deliveries}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
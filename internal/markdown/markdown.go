@@ -0,0 +1,340 @@
+// Package markdown renders message content written in a restricted Markdown dialect
+// to HTML that is safe to insert into a page.
+//
+// The dialect supports **bold**, *italics*, `code spans`, fenced code blocks,
+// [links](https://example.com) and flat bulleted or numbered lists. Everything else,
+// including raw HTML, is rendered as escaped text, so the output only ever contains
+// the tags emitted here.
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	bulletItemPattern  = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	orderedItemPattern = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	fencePattern       = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([^`\\s]*)")
+	languagePattern    = regexp.MustCompile(`^[A-Za-z0-9_+\-]+$`)
+)
+
+// Render converts the content to sanitized HTML.
+func Render(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+
+	r := renderer{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			r.closeBlock()
+			i = r.codeBlock(lines, i+1, m[1], m[2])
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			r.closeBlock()
+			continue
+		}
+		if m := bulletItemPattern.FindStringSubmatch(line); m != nil {
+			r.listItem("ul", 1, m[1])
+			continue
+		}
+		if m := orderedItemPattern.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			r.listItem("ol", start, m[2])
+			continue
+		}
+		r.paragraphLine(strings.TrimSpace(line))
+	}
+	r.closeBlock()
+	return strings.TrimSuffix(r.out.String(), "\n")
+}
+
+type renderer struct {
+	out strings.Builder
+	// block is the open block element: "p", "ul", "ol" or "" between blocks.
+	block string
+}
+
+func (r *renderer) closeBlock() {
+	if r.block != "" {
+		r.out.WriteString("</" + r.block + ">\n")
+		r.block = ""
+	}
+}
+
+func (r *renderer) paragraphLine(text string) {
+	if r.block == "p" {
+		r.out.WriteString("<br>\n")
+	} else {
+		r.closeBlock()
+		r.out.WriteString("<p>")
+		r.block = "p"
+	}
+	renderInline(&r.out, text, false)
+}
+
+func (r *renderer) listItem(tag string, start int, text string) {
+	if r.block != tag {
+		r.closeBlock()
+		if tag == "ol" && start != 1 {
+			r.out.WriteString(`<ol start="` + strconv.Itoa(start) + `">` + "\n")
+		} else {
+			r.out.WriteString("<" + tag + ">\n")
+		}
+		r.block = tag
+	}
+	r.out.WriteString("<li>")
+	renderInline(&r.out, strings.TrimSpace(text), false)
+	r.out.WriteString("</li>\n")
+}
+
+// codeBlock writes the fenced code starting at lines[from] and returns the index of the
+// closing fence. An unclosed fence runs to the end of the content.
+func (r *renderer) codeBlock(lines []string, from int, fence string, language string) int {
+	if languagePattern.MatchString(language) {
+		r.out.WriteString(`<pre><code class="language-` + language + `">`)
+	} else {
+		r.out.WriteString("<pre><code>")
+	}
+
+	i := from
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence[:3]) && strings.Trim(trimmed, fence[:1]) == "" && len(trimmed) >= len(fence) {
+			break
+		}
+		r.out.WriteString(escape(lines[i]))
+		r.out.WriteString("\n")
+	}
+	r.out.WriteString("</code></pre>\n")
+	return i
+}
+
+// renderInline writes text with code spans, emphasis and links. Inside the text of a
+// link no further links are recognized, so anchors never nest.
+func renderInline(b *strings.Builder, s string, inLink bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := findCodeSpanEnd(s, i+n, n); end >= 0 {
+				b.WriteString("<code>")
+				b.WriteString(escape(trimCodeSpan(s[i+n : end])))
+				b.WriteString("</code>")
+				i = end + n
+			} else {
+				b.WriteString(s[i : i+n])
+				i += n
+			}
+			continue
+
+		case c == '*' || c == '_':
+			if next, ok := renderEmphasis(b, s, i, inLink); ok {
+				i = next
+				continue
+			}
+			// A delimiter run that opens nothing is literal text.
+			n := runLength(s, i, c)
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case c == '[' && !inLink:
+			if next, ok := renderLink(b, s, i); ok {
+				i = next
+				continue
+			}
+		}
+
+		b.WriteString(escape(s[i : i+1]))
+		i++
+	}
+}
+
+// renderEmphasis writes the bold or italic span opening at s[i] and returns the index
+// after its closing delimiter. It reports false if the delimiter does not open a span.
+func renderEmphasis(b *strings.Builder, s string, i int, inLink bool) (int, bool) {
+	d := s[i]
+	width := runLength(s, i, d)
+	if width > 2 || !canOpen(s, i, width, d) {
+		return i, false
+	}
+	end := findClosing(s, i+width, d, width)
+	if end < 0 {
+		return i, false
+	}
+
+	tag := "em"
+	if width == 2 {
+		tag = "strong"
+	}
+	b.WriteString("<" + tag + ">")
+	renderInline(b, s[i+width:end], inLink)
+	b.WriteString("</" + tag + ">")
+	return end + width, true
+}
+
+// renderLink writes the [text](url) link opening at s[i] and returns the index after it.
+// Links to anything but http, https and mailto URLs are left as text.
+func renderLink(b *strings.Builder, s string, i int) (int, bool) {
+	closeText := findBracketEnd(s, i+1)
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return i, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL < 0 {
+		return i, false
+	}
+	href := strings.TrimSpace(s[closeText+2 : closeText+2+closeURL])
+	if !isSafeURL(href) {
+		return i, false
+	}
+
+	b.WriteString(`<a href="` + escape(href) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+	renderInline(b, s[i+1:closeText], true)
+	b.WriteString("</a>")
+	return closeText + 2 + closeURL + 1, true
+}
+
+// canOpen reports whether the delimiter run of the given width at s[i] can open a span.
+// Underscores inside words, as in snake_case, never do.
+func canOpen(s string, i int, width int, d byte) bool {
+	after := i + width
+	if after >= len(s) || isSpace(s[after]) {
+		return false
+	}
+	return d != '_' || i == 0 || !isAlnum(s[i-1])
+}
+
+// findClosing returns the index of the delimiter run of exactly the given width that
+// closes a span opened before s[from], skipping code spans and escaped characters.
+func findClosing(s string, from int, d byte, width int) int {
+	for j := from; j < len(s); {
+		switch s[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			n := runLength(s, j, '`')
+			if end := findCodeSpanEnd(s, j+n, n); end >= 0 {
+				j = end + n
+			} else {
+				j += n
+			}
+			continue
+		case d:
+			n := runLength(s, j, d)
+			after := j + n
+			if n == width && j > from && !isSpace(s[j-1]) && (d != '_' || after == len(s) || !isAlnum(s[after])) {
+				return j
+			}
+			j = after
+			continue
+		}
+		j++
+	}
+	return -1
+}
+
+// findBracketEnd returns the index of the ']' matching a '[' just before s[from].
+func findBracketEnd(s string, from int) int {
+	depth := 0
+	for j := from; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				return j
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// findCodeSpanEnd returns the index of the next run of exactly n backticks at or after from.
+func findCodeSpanEnd(s string, from int, n int) int {
+	for j := from; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j, '`')
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+// trimCodeSpan strips one space on each side so that “ `x` “ can show backticks.
+func trimCodeSpan(code string) string {
+	if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+		return code[1 : len(code)-1]
+	}
+	return code
+}
+
+func isSafeURL(href string) bool {
+	if href == "" || strings.ContainsAny(href, " \t\n<>\"'") {
+		return false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+var escaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#39;",
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
@@ -0,0 +1,195 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "plain text",
+			content: "hello",
+			want:    "<p>hello</p>",
+		},
+		{
+			name:    "script tag",
+			content: "<script>alert(1)</script>",
+			want:    "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		},
+		{
+			name:    "attribute payload",
+			content: `<img src=x onerror="alert(1)">`,
+			want:    "<p>&lt;img src=x onerror=&quot;alert(1)&quot;&gt;</p>",
+		},
+		{
+			name:    "quote breaking out of a link",
+			content: `[x](https://example.com/" onmouseover="alert(1))`,
+			want:    `<p>[x](https://example.com/&quot; onmouseover=&quot;alert(1))</p>`,
+		},
+		{
+			name:    "escaped characters in a link",
+			content: `[<b>](https://example.com/?a=1&b=2)`,
+			want:    `<p><a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer" target="_blank">&lt;b&gt;</a></p>`,
+		},
+		{
+			name:    "javascript link",
+			content: "[click](javascript:alert(1))",
+			want:    "<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			name:    "javascript link in mixed case",
+			content: "[click](JaVaScRiPt:alert(1))",
+			want:    "<p>[click](JaVaScRiPt:alert(1))</p>",
+		},
+		{
+			name:    "data link",
+			content: "[click](data:text/html,<script>alert(1)</script>)",
+			want:    "<p>[click](data:text/html,&lt;script&gt;alert(1)&lt;/script&gt;)</p>",
+		},
+		{
+			name:    "http link",
+			content: "[site](https://example.com)",
+			want:    `<p><a href="https://example.com" rel="nofollow noopener noreferrer" target="_blank">site</a></p>`,
+		},
+		{
+			name:    "mailto link",
+			content: "[mail](mailto:a@example.com)",
+			want:    `<p><a href="mailto:a@example.com" rel="nofollow noopener noreferrer" target="_blank">mail</a></p>`,
+		},
+		{
+			name:    "no nested links",
+			content: "[[a](https://a.example)](https://b.example)",
+			want:    `<p><a href="https://b.example" rel="nofollow noopener noreferrer" target="_blank">[a](https://a.example)</a></p>`,
+		},
+		{
+			name:    "bold and italics",
+			content: "**bold** and *italic* and _also_",
+			want:    "<p><strong>bold</strong> and <em>italic</em> and <em>also</em></p>",
+		},
+		{
+			name:    "nested emphasis",
+			content: "**bold *and italic* inside**",
+			want:    "<p><strong>bold <em>and italic</em> inside</strong></p>",
+		},
+		{
+			name:    "italics around bold",
+			content: "*italic **and bold** inside*",
+			want:    "<p><em>italic <strong>and bold</strong> inside</em></p>",
+		},
+		{
+			name:    "emphasis inside a link",
+			content: "[**bold**](https://example.com)",
+			want:    `<p><a href="https://example.com" rel="nofollow noopener noreferrer" target="_blank"><strong>bold</strong></a></p>`,
+		},
+		{
+			name:    "unclosed emphasis",
+			content: "**not bold",
+			want:    "<p>**not bold</p>",
+		},
+		{
+			name:    "underscores inside words",
+			content: "snake_case_name",
+			want:    "<p>snake_case_name</p>",
+		},
+		{
+			name:    "spaced asterisks",
+			content: "2 * 3 * 4",
+			want:    "<p>2 * 3 * 4</p>",
+		},
+		{
+			name:    "escaped delimiter",
+			content: `\*not italic\*`,
+			want:    "<p>*not italic*</p>",
+		},
+		{
+			name:    "code span",
+			content: "run `rm -rf /` now",
+			want:    "<p>run <code>rm -rf /</code> now</p>",
+		},
+		{
+			name:    "html in a code span",
+			content: "`<script>alert(1)</script>`",
+			want:    "<p><code>&lt;script&gt;alert(1)&lt;/script&gt;</code></p>",
+		},
+		{
+			name:    "emphasis in a code span",
+			content: "`**not bold**`",
+			want:    "<p><code>**not bold**</code></p>",
+		},
+		{
+			name:    "backticks in a code span",
+			content: "`` a`b ``",
+			want:    "<p><code>a`b</code></p>",
+		},
+		{
+			name:    "code span across an emphasis delimiter",
+			content: "*a `b*` c*",
+			want:    "<p><em>a <code>b*</code> c</em></p>",
+		},
+		{
+			name:    "unclosed code span",
+			content: "`open",
+			want:    "<p>`open</p>",
+		},
+		{
+			name:    "fenced code block",
+			content: "```go\nfmt.Println(\"<hi>\")\n```",
+			want:    "<pre><code class=\"language-go\">fmt.Println(&quot;&lt;hi&gt;&quot;)\n</code></pre>",
+		},
+		{
+			name:    "fence language payload",
+			content: "```\"><script>\nx\n```",
+			want:    "<pre><code>x\n</code></pre>",
+		},
+		{
+			name:    "lists",
+			content: "- one\n- **two**\n\n3. three\n4. four",
+			want:    "<ul>\n<li>one</li>\n<li><strong>two</strong></li>\n</ul>\n<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>",
+		},
+		{
+			name:    "paragraph lines",
+			content: "one\r\ntwo\n\nthree",
+			want:    "<p>one<br>\ntwo</p>\n<p>three</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.content); got != tt.want {
+				t.Errorf("Render(%q)\n got: %s\nwant: %s", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// No input, however malformed, may produce a tag or attribute that Render does not emit itself.
+func TestRenderEscapesRawHTML(t *testing.T) {
+	inputs := []string{
+		"<svg/onload=alert(1)>",
+		"**<b>**",
+		"*<i onclick=x>*",
+		"`` ` ``<a>",
+		"[<a href=x>](https://example.com)",
+		"[x](https://example.com)<iframe>",
+		"- <li>\n1. <ol>",
+		"```\n</code></pre><script>\n```",
+	}
+	allowed := []string{
+		"<p>", "</p>", "<br>", "<strong>", "</strong>", "<em>", "</em>", "<code>", "</code>",
+		"<pre>", "</pre>", "<ul>", "</ul>", "<ol>", "</ol>", "<li>", "</li>", "</a>",
+		`<a href="https://example.com" rel="nofollow noopener noreferrer" target="_blank">`,
+	}
+	for _, input := range inputs {
+		out := Render(input)
+		for _, tag := range allowed {
+			out = strings.ReplaceAll(out, tag, "")
+		}
+		if strings.ContainsAny(out, "<>") {
+			t.Errorf("Render(%q) = %q, has raw HTML", input, Render(input))
+		}
+	}
+}
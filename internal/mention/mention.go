@@ -0,0 +1,78 @@
+// Package mention finds the users that a message mentions with @name and notifies them.
+// Messages sent over a WebSocket and messages posted by incoming webhooks share it.
+package mention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([\w.\-]+)`)
+
+// Resolve the @name tokens of the content to the IDs of existing users other than the sender
+func Resolve(ctx context.Context, userRepo repository.UserRepository, content string, senderID string) []string {
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, config.MaxMentions) {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		user, err := userRepo.GetByName(ctx, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			log.Println(err)
+			continue
+		}
+		if user.ID != senderID {
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+	return userIDs
+}
+
+// Publish sends out a mention notification over pub/sub in the general channel so that
+// the mentioned users get it on any node, whether or not they have the room open. Only
+// members of the room are notified, as the notification carries the content.
+func Publish(ctx context.Context, roomRepo repository.RoomRepository, pubsubRepo repository.PubSubRepository, message *entity.Message) {
+	var recipients []string
+	for _, userID := range message.Mentions {
+		isMember, err := roomRepo.IsMember(ctx, message.TargetID, userID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if isMember {
+			recipients = append(recipients, userID)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	notification := &entity.Message{
+		ID:        message.ID,
+		Action:    config.MentionAction,
+		Content:   message.Content,
+		HTML:      message.HTML,
+		TargetID:  message.TargetID,
+		SenderID:  message.SenderID,
+		ParentID:  message.ParentID,
+		CreatedAt: message.CreatedAt,
+		Mentions:  recipients,
+	}
+
+	if err := pubsubRepo.Publish(ctx, config.PubSubGeneralChannel, notification.Encode()); err != nil {
+		log.Print(err)
+	}
+}
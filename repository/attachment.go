@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+// ErrAttachmentInUse is returned when a message references an attachment already sent in another message.
+var ErrAttachmentInUse = errors.New("attachment: already sent")
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment entity.Attachment) error
+	Get(ctx context.Context, id string) (*entity.Attachment, error)
+	Delete(ctx context.Context, id string) error
+	// ListByMessageIDs returns the attachments of each of the messages that has any.
+	ListByMessageIDs(ctx context.Context, messageIDs []string) (map[string][]*entity.Attachment, error)
+	// ListGarbage returns attachments whose message was deleted or redacted, and
+	// attachments never sent in a message that were uploaded before unsentBefore.
+	ListGarbage(ctx context.Context, unsentBefore time.Time) ([]*entity.Attachment, error)
+}
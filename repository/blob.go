@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrInvalidBlobKey = errors.New("blob: invalid key")
+
+// BlobStore keeps the content of uploaded files.
+type BlobStore interface {
+	// Put stores the content read from r under key and returns its size in bytes.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,78 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type blobStore struct {
+	dir string
+}
+
+func NewBlobStore(dir string) repository.BlobStore {
+	return &blobStore{
+		dir: dir,
+	}
+}
+
+// Put writes to a temporary file first so that a failed upload never leaves a partial blob.
+func (bs *blobStore) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	path, err := bs.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err = os.MkdirAll(bs.dir, 0o750); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(bs.dir, key+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (bs *blobStore) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := bs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (bs *blobStore) Delete(_ context.Context, key string) error {
+	path, err := bs.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Keys are plain file names; anything that could escape the directory is rejected.
+func (bs *blobStore) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || key != filepath.Base(key) {
+		return "", repository.ErrInvalidBlobKey
+	}
+	return filepath.Join(bs.dir, key), nil
+}
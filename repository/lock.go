@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// LockRepository hands out leases shared by all server nodes.
+type LockRepository interface {
+	// TryLock takes the lease on key for ttl and reports whether it was free.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
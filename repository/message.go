@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+var ErrInvalidCursor = errors.New("message: invalid cursor")
+
+type MessageRepository interface {
+	Create(ctx context.Context, message entity.Message) error
+	Get(ctx context.Context, id string) (*entity.Message, error)
+	// Update replaces the content of a message, keeping the previous content in its edit history,
+	// and reports whether it did. Redacted messages are left as they are.
+	Update(ctx context.Context, message entity.Message) (bool, error)
+	// Redact drops the content and the edit history of a message, leaving a tombstone.
+	Redact(ctx context.Context, message entity.Message) error
+	// List returns up to limit top-level messages of the room older than the cursor, newest first,
+	// together with the cursor of the next page. The next cursor is empty on the last page.
+	List(ctx context.Context, roomID string, before string, limit int) ([]*entity.Message, string, error)
+	// ListLatestAfter returns up to limit of the newest messages of the room newer than afterID, oldest first.
+	ListLatestAfter(ctx context.Context, roomID string, afterID string, limit int) ([]*entity.Message, error)
+	// ListRange returns up to limit messages of the room newer than afterID, oldest first,
+	// restricted to messages created at or after from and before to.
+	ListRange(ctx context.Context, roomID string, afterID string, from time.Time, to time.Time, limit int) ([]*entity.Message, error)
+	// ListReplies returns up to limit replies in the thread of parentID newer than afterID, oldest first.
+	ListReplies(ctx context.Context, parentID string, afterID string, limit int) ([]*entity.Message, error)
+	// CountUnread returns the number of visible messages in the room after afterID not sent by userID.
+	CountUnread(ctx context.Context, roomID string, afterID string, userID string) (int, error)
+	// Search returns up to limit messages matching the search, newest first.
+	Search(ctx context.Context, search entity.MessageSearch, limit int) ([]*entity.Message, error)
+	// DeleteBefore deletes the messages of the room created before the given time, with
+	// everything attached to them, and returns how many messages were deleted.
+	DeleteBefore(ctx context.Context, roomID string, before time.Time) (int64, error)
+	// DeleteExceptLatest deletes all but the latest keep messages of the room, with
+	// everything attached to them, and returns how many messages were deleted.
+	DeleteExceptLatest(ctx context.Context, roomID string, keep int) (int64, error)
+	// ListEdits returns the previous versions of a message, oldest first.
+	ListEdits(ctx context.Context, messageID string) ([]*entity.MessageEdit, error)
+}
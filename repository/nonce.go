@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type NonceRepository interface {
+	// Reserve binds the sender's nonce to messageID for ttl. If the nonce is already bound,
+	// the message ID it was bound to is returned instead.
+	Reserve(ctx context.Context, senderID string, nonce string, messageID string, ttl time.Duration) (string, error)
+	// Get returns the message ID the sender's nonce is bound to, or "" if it is not bound.
+	Get(ctx context.Context, senderID string, nonce string) (string, error)
+	Release(ctx context.Context, senderID string, nonce string) error
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+type OutgoingWebhookRepository interface {
+	Create(ctx context.Context, webhook entity.OutgoingWebhook) error
+	ListByRoom(ctx context.Context, roomID string) ([]*entity.OutgoingWebhook, error)
+	// Delete removes the webhook of the room with its delivery log and reports whether it existed.
+	Delete(ctx context.Context, roomID string, id string) (bool, error)
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// ListDeliveries returns up to limit attempts to deliver to the room's webhook, newest first.
+	ListDeliveries(ctx context.Context, roomID string, webhookID string, limit int) ([]*entity.WebhookDelivery, error)
+}
+
+// WebhookDispatcher delivers room events to the room's outgoing webhooks in the background.
+type WebhookDispatcher interface {
+	Dispatch(ctx context.Context, roomID string, event string, data any)
+}
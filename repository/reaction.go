@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+type ReactionRepository interface {
+	Add(ctx context.Context, reaction entity.Reaction) error
+	Remove(ctx context.Context, reaction entity.Reaction) error
+	// Count returns the number of users per emoji that reacted to the message.
+	Count(ctx context.Context, messageID string) (map[string]int, error)
+	// CountByMessageIDs returns Count for each of the messages that has reactions.
+	CountByMessageIDs(ctx context.Context, messageIDs []string) (map[string]map[string]int, error)
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+type ReadCursorRepository interface {
+	// Upsert moves the cursor forward and reports whether it moved. A cursor never moves back.
+	Upsert(ctx context.Context, cursor entity.ReadCursor) (bool, error)
+	Get(ctx context.Context, roomID string, userID string) (*entity.ReadCursor, error)
+	ListByRoom(ctx context.Context, roomID string) ([]*entity.ReadCursor, error)
+}
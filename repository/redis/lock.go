@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type lockRepository struct {
+	client *redis.Client
+}
+
+func NewLockRepository(client *redis.Client) repository.LockRepository {
+	return &lockRepository{
+		client: client,
+	}
+}
+
+func (lr *lockRepository) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return lr.client.SetNX(ctx, "lock:"+key, 1, ttl).Result()
+}
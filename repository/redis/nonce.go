@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type nonceRepository struct {
+	client *redis.Client
+}
+
+func NewNonceRepository(client *redis.Client) repository.NonceRepository {
+	return &nonceRepository{
+		client: client,
+	}
+}
+
+func (nr *nonceRepository) Reserve(ctx context.Context, senderID string, nonce string, messageID string, ttl time.Duration) (string, error) {
+	key := nonceKey(senderID, nonce)
+	ok, err := nr.client.SetNX(ctx, key, messageID, ttl).Result()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return messageID, nil
+	}
+	return nr.client.Get(ctx, key).Result()
+}
+
+func (nr *nonceRepository) Get(ctx context.Context, senderID string, nonce string) (string, error) {
+	messageID, err := nr.client.Get(ctx, nonceKey(senderID, nonce)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return messageID, err
+}
+
+func (nr *nonceRepository) Release(ctx context.Context, senderID string, nonce string) error {
+	return nr.client.Del(ctx, nonceKey(senderID, nonce)).Err()
+}
+
+func nonceKey(senderID string, nonce string) string {
+	return "nonce:" + senderID + ":" + nonce
+}
@@ -9,6 +9,21 @@ import (
 type RoomRepository interface {
 	Create(ctx context.Context, room entity.Room) error
 	Get(ctx context.Context, name string) (*entity.Room, error) // TODO: Change to ID
+	GetByID(ctx context.Context, id string) (*entity.Room, error)
+	AddModerator(ctx context.Context, roomID string, userID string) error
+	IsModerator(ctx context.Context, roomID string, userID string) (bool, error)
+	AddMember(ctx context.Context, roomID string, userID string) error
+	RemoveMember(ctx context.Context, roomID string, userID string) error
+	IsMember(ctx context.Context, roomID string, userID string) (bool, error)
+	ListByMember(ctx context.Context, userID string) ([]*entity.Room, error)
+	AddPin(ctx context.Context, pin entity.Pin) error
+	RemovePin(ctx context.Context, roomID string, messageID string) error
+	ListPins(ctx context.Context, roomID string) ([]*entity.Pin, error)
+	UpdateRetention(ctx context.Context, roomID string, days int, messages int) error
+	UpdateTopic(ctx context.Context, roomID string, topic string) error
+	List(ctx context.Context) ([]*entity.Room, error)
+	// ListWithRetention returns the rooms that do not keep their messages forever.
+	ListWithRetention(ctx context.Context) ([]*entity.Room, error)
 }
 
 type RoomWebSocketRepository interface {
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+type ScheduledMessageRepository interface {
+	Create(ctx context.Context, scheduled entity.ScheduledMessage) error
+	Get(ctx context.Context, id string) (*entity.ScheduledMessage, error)
+	// ListBySender returns the pending messages of the sender, soonest first.
+	ListBySender(ctx context.Context, senderID string) ([]*entity.ScheduledMessage, error)
+	// ListDue returns up to limit messages whose send time is not after now, oldest first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*entity.ScheduledMessage, error)
+	// Claim binds messageID to the schedule unless it is already bound, and returns the
+	// message ID it is bound to. It returns sql.ErrNoRows if the schedule no longer exists.
+	Claim(ctx context.Context, id string, messageID string) (string, error)
+	// Cancel deletes the sender's schedule if it has not been claimed, and reports whether it did.
+	Cancel(ctx context.Context, id string, senderID string) (bool, error)
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+const attachmentColumns = "attachments.id, attachments.room_id, attachments.message_id, attachments.uploader_id, " +
+	"attachments.name, attachments.size, attachments.mime_type, attachments.width, attachments.height, " +
+	"attachments.thumbnail_url, attachments.created_at"
+
+type attachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) repository.AttachmentRepository {
+	return &attachmentRepository{
+		db,
+	}
+}
+
+func (ar *attachmentRepository) Create(ctx context.Context, attachment entity.Attachment) error {
+	stmt, err := ar.db.Prepare(
+		"INSERT INTO attachments(id, room_id, uploader_id, name, size, mime_type, width, height, thumbnail_url, created_at) " +
+			"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(
+		ctx,
+		attachment.ID, attachment.RoomID, attachment.UploaderID, attachment.Name, attachment.Size, attachment.MIMEType,
+		attachment.Width, attachment.Height, attachment.ThumbnailURL, attachment.CreatedAt,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (ar *attachmentRepository) Get(ctx context.Context, id string) (*entity.Attachment, error) {
+	row := ar.db.QueryRowContext(ctx, "SELECT "+attachmentColumns+" FROM attachments WHERE id = ? LIMIT 1", id)
+
+	attachment, err := scanAttachment(row)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return attachment, nil
+}
+
+func (ar *attachmentRepository) Delete(ctx context.Context, id string) error {
+	stmt, err := ar.db.Prepare("DELETE FROM attachments WHERE id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (ar *attachmentRepository) ListByMessageIDs(ctx context.Context, messageIDs []string) (map[string][]*entity.Attachment, error) {
+	attachments := make(map[string][]*entity.Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	list, err := ar.queryAttachments(
+		ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE message_id IN ("+placeholders(len(messageIDs))+") ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range list {
+		attachments[attachment.MessageID] = append(attachments[attachment.MessageID], attachment)
+	}
+	return attachments, nil
+}
+
+func (ar *attachmentRepository) ListGarbage(ctx context.Context, unsentBefore time.Time) ([]*entity.Attachment, error) {
+	return ar.queryAttachments(
+		ctx,
+		"SELECT "+attachmentColumns+" FROM attachments LEFT JOIN messages ON messages.id = attachments.message_id "+
+			"WHERE (attachments.message_id IS NOT NULL AND (messages.id IS NULL OR messages.deleted_at IS NOT NULL)) "+
+			"OR (attachments.message_id IS NULL AND attachments.created_at < ?)",
+		unsentBefore.UTC(),
+	)
+}
+
+func (ar *attachmentRepository) queryAttachments(ctx context.Context, query string, args ...any) ([]*entity.Attachment, error) {
+	rows, err := ar.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*entity.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func scanAttachment(row rowScanner) (*entity.Attachment, error) {
+	var attachment entity.Attachment
+	var messageID sql.NullString
+	if err := row.Scan(
+		&attachment.ID, &attachment.RoomID, &messageID, &attachment.UploaderID,
+		&attachment.Name, &attachment.Size, &attachment.MIMEType, &attachment.Width, &attachment.Height,
+		&attachment.ThumbnailURL, &attachment.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	attachment.MessageID = messageID.String
+	return &attachment, nil
+}
@@ -0,0 +1,382 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+const messageColumns = "id, room_id, sender_id, content, created_at, edited_at, deleted_at, parent_id, " +
+	"(SELECT COUNT(*) FROM messages AS replies WHERE replies.parent_id = messages.id), " +
+	"(SELECT GROUP_CONCAT(user_id) FROM message_mentions WHERE message_mentions.message_id = messages.id)"
+
+type messageRepository struct {
+	db *sql.DB
+}
+
+func NewMessageRepository(db *sql.DB) repository.MessageRepository {
+	return &messageRepository{
+		db,
+	}
+}
+
+func (mr *messageRepository) Create(ctx context.Context, message entity.Message) error {
+	tx, err := mr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO messages(id, room_id, sender_id, content, created_at, parent_id) values(?, ?, ?, ?, ?, ?)",
+		message.ID, message.TargetID, message.SenderID, message.Content, message.CreatedAt, nullString(message.ParentID),
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, attachment := range message.Attachments {
+		var res sql.Result
+		res, err = tx.ExecContext(ctx, "UPDATE attachments SET message_id = ? WHERE id = ? AND message_id IS NULL", message.ID, attachment.ID)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		// Another message claimed the attachment after it was resolved.
+		if n, _ := res.RowsAffected(); n == 0 {
+			return repository.ErrAttachmentInUse
+		}
+	}
+	for _, userID := range message.Mentions {
+		_, err = tx.ExecContext(ctx, "INSERT OR IGNORE INTO message_mentions(message_id, user_id) values(?, ?)", message.ID, userID)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (mr *messageRepository) Get(ctx context.Context, id string) (*entity.Message, error) {
+	row := mr.db.QueryRowContext(ctx, "SELECT "+messageColumns+" FROM messages WHERE id = ? LIMIT 1", id)
+
+	message, err := scanMessage(row)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return message, nil
+}
+
+// Update replaces the content of the message and keeps the previous content as an edit.
+func (mr *messageRepository) Update(ctx context.Context, message entity.Message) (bool, error) {
+	tx, err := mr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO message_edits(message_id, content, edited_at) SELECT id, content, ? FROM messages WHERE id = ? AND deleted_at IS NULL",
+		message.EditedAt, message.ID,
+	)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE messages SET content = ?, edited_at = ? WHERE id = ? AND deleted_at IS NULL",
+		message.Content, message.EditedAt, message.ID,
+	)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (mr *messageRepository) Redact(ctx context.Context, message entity.Message) error {
+	tx, err := mr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	for _, table := range []string{"message_edits", "message_reactions", "room_pins"} {
+		_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE message_id = ?", message.ID)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE messages SET content = '', deleted_at = ? WHERE id = ?", message.DeletedAt, message.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (mr *messageRepository) List(ctx context.Context, roomID string, before string, limit int) ([]*entity.Message, string, error) {
+	query := "SELECT " + messageColumns + " FROM messages WHERE room_id = ? AND parent_id IS NULL"
+	args := []any{roomID}
+	if before != "" {
+		beforeID, err := decodeCursor(before)
+		if err != nil {
+			return nil, "", err
+		}
+		query += " AND id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	// Fetch one extra row to know whether another page exists.
+	args = append(args, limit+1)
+
+	messages, err := mr.queryMessages(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(messages) <= limit {
+		return messages, "", nil
+	}
+	return messages[:limit], encodeCursor(messages[limit-1].ID), nil
+}
+
+func (mr *messageRepository) ListLatestAfter(ctx context.Context, roomID string, afterID string, limit int) ([]*entity.Message, error) {
+	messages, err := mr.queryMessages(
+		ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND id > ? ORDER BY id DESC LIMIT ?",
+		roomID, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+func (mr *messageRepository) ListRange(ctx context.Context, roomID string, afterID string, from time.Time, to time.Time, limit int) ([]*entity.Message, error) {
+	return mr.queryMessages(
+		ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND id > ? AND created_at >= ? AND created_at < ? ORDER BY id ASC LIMIT ?",
+		roomID, afterID, from.UTC(), to.UTC(), limit,
+	)
+}
+
+func (mr *messageRepository) ListReplies(ctx context.Context, parentID string, afterID string, limit int) ([]*entity.Message, error) {
+	return mr.queryMessages(
+		ctx,
+		"SELECT "+messageColumns+" FROM messages WHERE parent_id = ? AND id > ? ORDER BY id ASC LIMIT ?",
+		parentID, afterID, limit,
+	)
+}
+
+func (mr *messageRepository) CountUnread(ctx context.Context, roomID string, afterID string, userID string) (int, error) {
+	var count int
+	row := mr.db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM messages WHERE room_id = ? AND id > ? AND sender_id != ? AND deleted_at IS NULL",
+		roomID, afterID, userID,
+	)
+
+	if err := row.Scan(&count); err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (mr *messageRepository) Search(ctx context.Context, search entity.MessageSearch, limit int) ([]*entity.Message, error) {
+	if len(search.RoomIDs) == 0 {
+		return nil, nil
+	}
+
+	query := "SELECT " + messageColumns + " FROM messages WHERE room_id IN (" + placeholders(len(search.RoomIDs)) + ") AND deleted_at IS NULL"
+	var args []any
+	for _, roomID := range search.RoomIDs {
+		args = append(args, roomID)
+	}
+	if search.Match != "" {
+		query += " AND seq IN (SELECT rowid FROM messages_fts WHERE messages_fts MATCH ?)"
+		args = append(args, search.Match)
+	}
+	if search.SenderID != "" {
+		query += " AND sender_id = ?"
+		args = append(args, search.SenderID)
+	}
+	if !search.After.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, search.After.UTC())
+	}
+	if !search.Before.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, search.Before.UTC())
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	return mr.queryMessages(ctx, query, args...)
+}
+
+func (mr *messageRepository) DeleteBefore(ctx context.Context, roomID string, before time.Time) (int64, error) {
+	return mr.deleteWhere(ctx, "room_id = ? AND created_at < ?", roomID, before.UTC())
+}
+
+func (mr *messageRepository) DeleteExceptLatest(ctx context.Context, roomID string, keep int) (int64, error) {
+	return mr.deleteWhere(
+		ctx,
+		"room_id = ? AND id NOT IN (SELECT id FROM messages WHERE room_id = ? ORDER BY id DESC LIMIT ?)",
+		roomID, roomID, keep,
+	)
+}
+
+// deleteWhere deletes the messages matching the condition along with their edits,
+// reactions, mentions and pins.
+func (mr *messageRepository) deleteWhere(ctx context.Context, condition string, args ...any) (int64, error) {
+	tx, err := mr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	for _, table := range []string{"message_edits", "message_reactions", "message_mentions", "room_pins"} {
+		_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE message_id IN (SELECT id FROM messages WHERE "+condition+")", args...)
+		if err != nil {
+			log.Println(err)
+			return 0, err
+		}
+	}
+	result, err := tx.ExecContext(ctx, "DELETE FROM messages WHERE "+condition, args...)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return deleted, tx.Commit()
+}
+
+func (mr *messageRepository) ListEdits(ctx context.Context, messageID string) ([]*entity.MessageEdit, error) {
+	rows, err := mr.db.QueryContext(ctx, "SELECT message_id, content, edited_at FROM message_edits WHERE message_id = ? ORDER BY id ASC", messageID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []*entity.MessageEdit
+	for rows.Next() {
+		var edit entity.MessageEdit
+		if err = rows.Scan(&edit.MessageID, &edit.Content, &edit.EditedAt); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		edits = append(edits, &edit)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return edits, nil
+}
+
+func (mr *messageRepository) queryMessages(ctx context.Context, query string, args ...any) ([]*entity.Message, error) {
+	rows, err := mr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*entity.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return messages, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (*entity.Message, error) {
+	message := entity.Message{Action: config.SendMessageAction}
+	var editedAt, deletedAt sql.NullTime
+	var parentID, mentions sql.NullString
+	if err := row.Scan(
+		&message.ID, &message.TargetID, &message.SenderID, &message.Content, &message.CreatedAt,
+		&editedAt, &deletedAt, &parentID, &message.ReplyCount, &mentions,
+	); err != nil {
+		return nil, err
+	}
+	message.ParentID = parentID.String
+	if mentions.Valid {
+		message.Mentions = strings.Split(mentions.String, ",")
+	}
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+	return &message, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) == 0 {
+		return "", repository.ErrInvalidCursor
+	}
+	return string(b), nil
+}
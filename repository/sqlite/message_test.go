@@ -0,0 +1,64 @@
+//go:build sqlite_fts5
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db := config.OpenDB(filepath.Join(t.TempDir(), "chat.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func countRows(t *testing.T, db *sql.DB, table string, messageID string) int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE message_id = ?", messageID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestRedactRemovesReactionsAndPins(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	mr := NewMessageRepository(db)
+	now := time.Now().UTC()
+
+	message := entity.Message{ID: "message", TargetID: "room", SenderID: "user", Content: "hello", CreatedAt: now}
+	if err := mr.Create(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewReactionRepository(db).Add(ctx, entity.Reaction{MessageID: message.ID, UserID: "user", Emoji: "👍"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRoomRepository(db).AddPin(ctx, entity.Pin{RoomID: "room", MessageID: message.ID, PinnedBy: "user", PinnedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	message.DeletedAt = &now
+	if err := mr.Redact(ctx, message); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"message_reactions", "room_pins"} {
+		if n := countRows(t, db, table, message.ID); n != 0 {
+			t.Errorf("%s has %d rows of the redacted message, want 0", table, n)
+		}
+	}
+	stored, err := mr.Get(ctx, message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Content != "" || stored.DeletedAt == nil {
+		t.Errorf("stored = %+v, want redacted", stored)
+	}
+}
@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type outgoingWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewOutgoingWebhookRepository(db *sql.DB) repository.OutgoingWebhookRepository {
+	return &outgoingWebhookRepository{
+		db,
+	}
+}
+
+func (owr *outgoingWebhookRepository) Create(ctx context.Context, webhook entity.OutgoingWebhook) error {
+	stmt, err := owr.db.Prepare("INSERT INTO outgoing_webhooks(id, room_id, url, events, secret, created_by, created_at) values(?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(
+		ctx,
+		webhook.ID, webhook.RoomID, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, webhook.CreatedBy, webhook.CreatedAt,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (owr *outgoingWebhookRepository) ListByRoom(ctx context.Context, roomID string) ([]*entity.OutgoingWebhook, error) {
+	rows, err := owr.db.QueryContext(
+		ctx,
+		"SELECT id, room_id, url, events, secret, created_by, created_at FROM outgoing_webhooks WHERE room_id = ? ORDER BY created_at",
+		roomID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*entity.OutgoingWebhook
+	for rows.Next() {
+		var webhook entity.OutgoingWebhook
+		var events string
+		if err = rows.Scan(
+			&webhook.ID, &webhook.RoomID, &webhook.URL, &events, &webhook.Secret, &webhook.CreatedBy, &webhook.CreatedAt,
+		); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (owr *outgoingWebhookRepository) Delete(ctx context.Context, roomID string, id string) (bool, error) {
+	tx, err := owr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM outgoing_webhooks WHERE room_id = ? AND id = ?", roomID, id)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (owr *outgoingWebhookRepository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	stmt, err := owr.db.Prepare(
+		"INSERT INTO webhook_deliveries(id, webhook_id, event_id, event, attempt, status_code, error, succeeded, created_at) " +
+			"values(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(
+		ctx,
+		delivery.ID, delivery.WebhookID, delivery.EventID, delivery.Event, delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.Succeeded, delivery.CreatedAt,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (owr *outgoingWebhookRepository) ListDeliveries(ctx context.Context, roomID string, webhookID string, limit int) ([]*entity.WebhookDelivery, error) {
+	rows, err := owr.db.QueryContext(
+		ctx,
+		"SELECT d.id, d.webhook_id, d.event_id, d.event, d.attempt, d.status_code, d.error, d.succeeded, d.created_at "+
+			"FROM webhook_deliveries d JOIN outgoing_webhooks w ON w.id = d.webhook_id "+
+			"WHERE w.room_id = ? AND d.webhook_id = ? ORDER BY d.id DESC LIMIT ?",
+		roomID, webhookID, limit,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*entity.WebhookDelivery
+	for rows.Next() {
+		var delivery entity.WebhookDelivery
+		if err = rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.Event, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &delivery.Succeeded, &delivery.CreatedAt,
+		); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type reactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) repository.ReactionRepository {
+	return &reactionRepository{
+		db,
+	}
+}
+
+func (rr *reactionRepository) Add(ctx context.Context, reaction entity.Reaction) error {
+	stmt, err := rr.db.Prepare("INSERT OR IGNORE INTO message_reactions(message_id, user_id, emoji) values(?, ?, ?)")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, reaction.MessageID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *reactionRepository) Remove(ctx context.Context, reaction entity.Reaction) error {
+	stmt, err := rr.db.Prepare("DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, reaction.MessageID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *reactionRepository) Count(ctx context.Context, messageID string) (map[string]int, error) {
+	counts, err := rr.CountByMessageIDs(ctx, []string{messageID})
+	if err != nil {
+		return nil, err
+	}
+	return counts[messageID], nil
+}
+
+func (rr *reactionRepository) CountByMessageIDs(ctx context.Context, messageIDs []string) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := rr.db.QueryContext(
+		ctx,
+		"SELECT message_id, emoji, COUNT(*) FROM message_reactions WHERE message_id IN ("+placeholders(len(messageIDs))+") GROUP BY message_id, emoji",
+		args...,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, emoji string
+		var count int
+		if err = rows.Scan(&messageID, &emoji, &count); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if counts[messageID] == nil {
+			counts[messageID] = make(map[string]int)
+		}
+		counts[messageID][emoji] = count
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type readCursorRepository struct {
+	db *sql.DB
+}
+
+func NewReadCursorRepository(db *sql.DB) repository.ReadCursorRepository {
+	return &readCursorRepository{
+		db,
+	}
+}
+
+func (rr *readCursorRepository) Upsert(ctx context.Context, cursor entity.ReadCursor) (bool, error) {
+	stmt, err := rr.db.Prepare(`
+	INSERT INTO read_cursors(room_id, user_id, message_id, updated_at) values(?, ?, ?, ?)
+	ON CONFLICT(room_id, user_id) DO UPDATE SET message_id = excluded.message_id, updated_at = excluded.updated_at
+	WHERE excluded.message_id > read_cursors.message_id
+	`)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	result, err := stmt.ExecContext(ctx, cursor.RoomID, cursor.UserID, cursor.MessageID, cursor.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (rr *readCursorRepository) Get(ctx context.Context, roomID string, userID string) (*entity.ReadCursor, error) {
+	var cursor entity.ReadCursor
+	row := rr.db.QueryRowContext(
+		ctx,
+		"SELECT room_id, user_id, message_id, updated_at FROM read_cursors WHERE room_id = ? AND user_id = ? LIMIT 1",
+		roomID, userID,
+	)
+
+	if err := row.Scan(&cursor.RoomID, &cursor.UserID, &cursor.MessageID, &cursor.UpdatedAt); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (rr *readCursorRepository) ListByRoom(ctx context.Context, roomID string) ([]*entity.ReadCursor, error) {
+	var cursors []*entity.ReadCursor
+	rows, err := rr.db.QueryContext(ctx, "SELECT room_id, user_id, message_id, updated_at FROM read_cursors WHERE room_id = ?", roomID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cursor entity.ReadCursor
+		if err = rows.Scan(&cursor.RoomID, &cursor.UserID, &cursor.MessageID, &cursor.UpdatedAt); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		cursors = append(cursors, &cursor)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return cursors, nil
+}
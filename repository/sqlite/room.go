@@ -9,6 +9,8 @@ import (
 	"github.com/tusmasoma/simple-chat/repository"
 )
 
+const roomColumns = "rooms.id, rooms.name, rooms.private, rooms.retention_days, rooms.retention_messages, rooms.topic, rooms.direct"
+
 type roomRepository struct {
 	db *sql.DB
 }
@@ -20,12 +22,12 @@ func NewRoomRepository(db *sql.DB) repository.RoomRepository {
 }
 
 func (rr *roomRepository) Create(ctx context.Context, room entity.Room) error {
-	stmt, err := rr.db.Prepare("INSERT INTO rooms(id, name, private) values(?, ?, ?)")
+	stmt, err := rr.db.Prepare("INSERT INTO rooms(id, name, private, direct) values(?, ?, ?, ?)")
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	_, err = stmt.ExecContext(ctx, room.ID, room.Name, room.Private)
+	_, err = stmt.ExecContext(ctx, room.ID, room.Name, room.Private, room.Direct)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -35,11 +37,210 @@ func (rr *roomRepository) Create(ctx context.Context, room entity.Room) error {
 
 func (rr *roomRepository) Get(ctx context.Context, name string) (*entity.Room, error) {
 	var room entity.Room
-	row := rr.db.QueryRowContext(ctx, "SELECT id, name, private FROM rooms WHERE name = ? LIMIT 1", name)
+	row := rr.db.QueryRowContext(ctx, "SELECT "+roomColumns+" FROM rooms WHERE name = ? LIMIT 1", name)
+
+	if err := row.Scan(&room.ID, &room.Name, &room.Private, &room.RetentionDays, &room.RetentionMessages, &room.Topic, &room.Direct); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (rr *roomRepository) GetByID(ctx context.Context, id string) (*entity.Room, error) {
+	var room entity.Room
+	row := rr.db.QueryRowContext(ctx, "SELECT "+roomColumns+" FROM rooms WHERE id = ? LIMIT 1", id)
 
-	if err := row.Scan(&room.ID, &room.Name, &room.Private); err != nil {
+	if err := row.Scan(&room.ID, &room.Name, &room.Private, &room.RetentionDays, &room.RetentionMessages, &room.Topic, &room.Direct); err != nil {
 		log.Println(err)
 		return nil, err
 	}
 	return &room, nil
 }
+
+func (rr *roomRepository) AddModerator(ctx context.Context, roomID string, userID string) error {
+	stmt, err := rr.db.Prepare("INSERT OR IGNORE INTO room_moderators(room_id, user_id) values(?, ?)")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, roomID, userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) IsModerator(ctx context.Context, roomID string, userID string) (bool, error) {
+	var count int
+	row := rr.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM room_moderators WHERE room_id = ? AND user_id = ?", roomID, userID)
+
+	if err := row.Scan(&count); err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (rr *roomRepository) AddMember(ctx context.Context, roomID string, userID string) error {
+	stmt, err := rr.db.Prepare("INSERT OR IGNORE INTO room_members(room_id, user_id) values(?, ?)")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, roomID, userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) RemoveMember(ctx context.Context, roomID string, userID string) error {
+	stmt, err := rr.db.Prepare("DELETE FROM room_members WHERE room_id = ? AND user_id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, roomID, userID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) IsMember(ctx context.Context, roomID string, userID string) (bool, error) {
+	var count int
+	row := rr.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM room_members WHERE room_id = ? AND user_id = ?", roomID, userID)
+
+	if err := row.Scan(&count); err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (rr *roomRepository) ListByMember(ctx context.Context, userID string) ([]*entity.Room, error) {
+	return rr.queryRooms(
+		ctx,
+		"SELECT "+roomColumns+" FROM rooms JOIN room_members ON room_members.room_id = rooms.id WHERE room_members.user_id = ?",
+		userID,
+	)
+}
+
+func (rr *roomRepository) AddPin(ctx context.Context, pin entity.Pin) error {
+	stmt, err := rr.db.Prepare("INSERT OR IGNORE INTO room_pins(room_id, message_id, pinned_by, pinned_at) values(?, ?, ?, ?)")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, pin.RoomID, pin.MessageID, pin.PinnedBy, pin.PinnedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) RemovePin(ctx context.Context, roomID string, messageID string) error {
+	stmt, err := rr.db.Prepare("DELETE FROM room_pins WHERE room_id = ? AND message_id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, roomID, messageID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) ListPins(ctx context.Context, roomID string) ([]*entity.Pin, error) {
+	var pins []*entity.Pin
+	rows, err := rr.db.QueryContext(
+		ctx,
+		"SELECT room_id, message_id, pinned_by, pinned_at FROM room_pins WHERE room_id = ? ORDER BY pinned_at DESC",
+		roomID,
+	)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pin entity.Pin
+		if err = rows.Scan(&pin.RoomID, &pin.MessageID, &pin.PinnedBy, &pin.PinnedAt); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		pins = append(pins, &pin)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return pins, nil
+}
+
+func (rr *roomRepository) UpdateRetention(ctx context.Context, roomID string, days int, messages int) error {
+	stmt, err := rr.db.Prepare("UPDATE rooms SET retention_days = ?, retention_messages = ? WHERE id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, days, messages, roomID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) UpdateTopic(ctx context.Context, roomID string, topic string) error {
+	stmt, err := rr.db.Prepare("UPDATE rooms SET topic = ? WHERE id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, topic, roomID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (rr *roomRepository) List(ctx context.Context) ([]*entity.Room, error) {
+	return rr.queryRooms(ctx, "SELECT "+roomColumns+" FROM rooms")
+}
+
+func (rr *roomRepository) ListWithRetention(ctx context.Context) ([]*entity.Room, error) {
+	return rr.queryRooms(ctx, "SELECT "+roomColumns+" FROM rooms WHERE retention_days > 0 OR retention_messages > 0")
+}
+
+func (rr *roomRepository) queryRooms(ctx context.Context, query string, args ...any) ([]*entity.Room, error) {
+	var rooms []*entity.Room
+	rows, err := rr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room entity.Room
+		if err = rows.Scan(&room.ID, &room.Name, &room.Private, &room.RetentionDays, &room.RetentionMessages, &room.Topic, &room.Direct); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return rooms, nil
+}
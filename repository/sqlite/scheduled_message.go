@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+const scheduledMessageColumns = "id, room_id, sender_id, content, parent_id, send_at, message_id, created_at"
+
+type scheduledMessageRepository struct {
+	db *sql.DB
+}
+
+func NewScheduledMessageRepository(db *sql.DB) repository.ScheduledMessageRepository {
+	return &scheduledMessageRepository{
+		db,
+	}
+}
+
+func (smr *scheduledMessageRepository) Create(ctx context.Context, scheduled entity.ScheduledMessage) error {
+	stmt, err := smr.db.Prepare(
+		"INSERT INTO scheduled_messages(id, room_id, sender_id, content, parent_id, send_at, created_at) values(?, ?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(
+		ctx,
+		scheduled.ID, scheduled.RoomID, scheduled.SenderID, scheduled.Content, nullString(scheduled.ParentID),
+		scheduled.SendAt.UTC(), scheduled.CreatedAt,
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (smr *scheduledMessageRepository) Get(ctx context.Context, id string) (*entity.ScheduledMessage, error) {
+	row := smr.db.QueryRowContext(ctx, "SELECT "+scheduledMessageColumns+" FROM scheduled_messages WHERE id = ? LIMIT 1", id)
+
+	scheduled, err := scanScheduledMessage(row)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+func (smr *scheduledMessageRepository) ListBySender(ctx context.Context, senderID string) ([]*entity.ScheduledMessage, error) {
+	return smr.queryScheduledMessages(
+		ctx,
+		"SELECT "+scheduledMessageColumns+" FROM scheduled_messages WHERE sender_id = ? AND message_id IS NULL ORDER BY send_at, id",
+		senderID,
+	)
+}
+
+func (smr *scheduledMessageRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*entity.ScheduledMessage, error) {
+	return smr.queryScheduledMessages(
+		ctx,
+		"SELECT "+scheduledMessageColumns+" FROM scheduled_messages WHERE send_at <= ? ORDER BY send_at, id LIMIT ?",
+		now.UTC(), limit,
+	)
+}
+
+func (smr *scheduledMessageRepository) Claim(ctx context.Context, id string, messageID string) (string, error) {
+	_, err := smr.db.ExecContext(
+		ctx,
+		"UPDATE scheduled_messages SET message_id = ? WHERE id = ? AND message_id IS NULL",
+		messageID, id,
+	)
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	var claimed sql.NullString
+	row := smr.db.QueryRowContext(ctx, "SELECT message_id FROM scheduled_messages WHERE id = ?", id)
+	if err = row.Scan(&claimed); err != nil {
+		return "", err
+	}
+	return claimed.String, nil
+}
+
+func (smr *scheduledMessageRepository) Cancel(ctx context.Context, id string, senderID string) (bool, error) {
+	res, err := smr.db.ExecContext(
+		ctx,
+		"DELETE FROM scheduled_messages WHERE id = ? AND sender_id = ? AND message_id IS NULL",
+		id, senderID,
+	)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (smr *scheduledMessageRepository) Delete(ctx context.Context, id string) error {
+	stmt, err := smr.db.Prepare("DELETE FROM scheduled_messages WHERE id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (smr *scheduledMessageRepository) queryScheduledMessages(ctx context.Context, query string, args ...any) ([]*entity.ScheduledMessage, error) {
+	rows, err := smr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*entity.ScheduledMessage
+	for rows.Next() {
+		scheduled, err := scanScheduledMessage(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		list = append(list, scheduled)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return list, nil
+}
+
+func scanScheduledMessage(row rowScanner) (*entity.ScheduledMessage, error) {
+	var scheduled entity.ScheduledMessage
+	var parentID, messageID sql.NullString
+	if err := row.Scan(
+		&scheduled.ID, &scheduled.RoomID, &scheduled.SenderID, &scheduled.Content, &parentID,
+		&scheduled.SendAt, &messageID, &scheduled.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	scheduled.ParentID = parentID.String
+	scheduled.MessageID = messageID.String
+	return &scheduled, nil
+}
@@ -69,6 +69,20 @@ func (ur *userRepository) GetByName(ctx context.Context, name string) (*entity.U
 	return &user, nil
 }
 
+func (ur *userRepository) UpdateName(ctx context.Context, id string, name string) error {
+	stmt, err := ur.db.Prepare("UPDATE users SET name = ? WHERE id = ?")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, name, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
 func (ur *userRepository) List(ctx context.Context) ([]*entity.User, error) {
 	var users []*entity.User
 	rows, err := ur.db.QueryContext(ctx, "SELECT * FROM users")
@@ -0,0 +1,88 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+const incomingWebhookColumns = "id, room_id, name, token_hash, created_by, created_at"
+
+type incomingWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewIncomingWebhookRepository(db *sql.DB) repository.IncomingWebhookRepository {
+	return &incomingWebhookRepository{
+		db,
+	}
+}
+
+func (iwr *incomingWebhookRepository) Create(ctx context.Context, webhook entity.IncomingWebhook) error {
+	stmt, err := iwr.db.Prepare("INSERT INTO incoming_webhooks(id, room_id, name, token_hash, created_by, created_at) values(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, webhook.ID, webhook.RoomID, webhook.Name, webhook.TokenHash, webhook.CreatedBy, webhook.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func (iwr *incomingWebhookRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*entity.IncomingWebhook, error) {
+	var webhook entity.IncomingWebhook
+	row := iwr.db.QueryRowContext(ctx, "SELECT "+incomingWebhookColumns+" FROM incoming_webhooks WHERE token_hash = ? LIMIT 1", tokenHash)
+
+	if err := row.Scan(
+		&webhook.ID, &webhook.RoomID, &webhook.Name, &webhook.TokenHash, &webhook.CreatedBy, &webhook.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (iwr *incomingWebhookRepository) ListByRoom(ctx context.Context, roomID string) ([]*entity.IncomingWebhook, error) {
+	rows, err := iwr.db.QueryContext(ctx, "SELECT "+incomingWebhookColumns+" FROM incoming_webhooks WHERE room_id = ? ORDER BY created_at", roomID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*entity.IncomingWebhook
+	for rows.Next() {
+		var webhook entity.IncomingWebhook
+		if err = rows.Scan(
+			&webhook.ID, &webhook.RoomID, &webhook.Name, &webhook.TokenHash, &webhook.CreatedBy, &webhook.CreatedAt,
+		); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (iwr *incomingWebhookRepository) Delete(ctx context.Context, roomID string, id string) (bool, error) {
+	res, err := iwr.db.ExecContext(ctx, "DELETE FROM incoming_webhooks WHERE room_id = ? AND id = ?", roomID, id)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -11,6 +11,7 @@ type UserRepository interface {
 	Delete(ctx context.Context, id string) error
 	Get(ctx context.Context, id string) (*entity.User, error)
 	GetByName(ctx context.Context, name string) (*entity.User, error)
+	UpdateName(ctx context.Context, id string, name string) error
 	List(ctx context.Context) ([]*entity.User, error)
 }
 
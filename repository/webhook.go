@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+type IncomingWebhookRepository interface {
+	Create(ctx context.Context, webhook entity.IncomingWebhook) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*entity.IncomingWebhook, error)
+	ListByRoom(ctx context.Context, roomID string) ([]*entity.IncomingWebhook, error)
+	// Delete removes the webhook of the room and reports whether it existed.
+	Delete(ctx context.Context, roomID string, id string) (bool, error)
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret, prefixed with "sha256=".
+const (
+	EventIDHeader   = "X-Webhook-ID"
+	EventHeader     = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+type dispatcher struct {
+	owr            repository.OutgoingWebhookRepository
+	client         *http.Client
+	initialBackoff time.Duration
+}
+
+func NewWebhookDispatcher(owr repository.OutgoingWebhookRepository, client *http.Client, initialBackoff time.Duration) repository.WebhookDispatcher {
+	return &dispatcher{
+		owr:            owr,
+		client:         client,
+		initialBackoff: initialBackoff,
+	}
+}
+
+// Dispatch returns once the event is encoded; every subscribed webhook of the room
+// receives it from its own goroutine so a slow receiver holds up nothing else.
+func (d *dispatcher) Dispatch(ctx context.Context, roomID string, event string, data any) {
+	webhooks, err := d.owr.ListByRoom(ctx, roomID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	body, err := json.Marshal(entity.WebhookEvent{
+		ID:        id.String(),
+		Event:     event,
+		RoomID:    roomID,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if slices.Contains(webhook.Events, event) {
+			go d.deliver(ctx, webhook, id.String(), event, body)
+		}
+	}
+}
+
+// Post the event until the receiver accepts it, waiting twice as long after every failure.
+// Every attempt is recorded in the delivery log.
+func (d *dispatcher) deliver(ctx context.Context, webhook *entity.OutgoingWebhook, eventID string, event string, body []byte) {
+	backoff := d.initialBackoff
+	for attempt := 1; attempt <= config.WebhookMaxAttempts; attempt++ {
+		statusCode, err := d.post(ctx, webhook, eventID, event, body)
+
+		delivery := entity.WebhookDelivery{
+			WebhookID:  webhook.ID,
+			EventID:    eventID,
+			Event:      event,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Succeeded:  err == nil,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		d.logDelivery(ctx, delivery)
+
+		if err == nil || !retryable(statusCode) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (d *dispatcher) post(ctx context.Context, webhook *entity.OutgoingWebhook, eventID string, event string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, eventID)
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10)) //nolint:errcheck // best effort
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *dispatcher) logDelivery(ctx context.Context, delivery entity.WebhookDelivery) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	delivery.ID = id.String()
+	if err = d.owr.CreateDelivery(ctx, delivery); err != nil {
+		log.Println(err)
+	}
+}
+
+// Sign returns the signature header value of a delivery body sent at timestamp.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Network errors, rate limiting and server errors may pass; other client errors will not.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
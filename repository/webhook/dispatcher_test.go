@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+type fakeOutgoingWebhookRepository struct {
+	webhooks   []*entity.OutgoingWebhook
+	deliveries chan entity.WebhookDelivery
+}
+
+func (r *fakeOutgoingWebhookRepository) Create(context.Context, entity.OutgoingWebhook) error {
+	return nil
+}
+
+func (r *fakeOutgoingWebhookRepository) ListByRoom(context.Context, string) ([]*entity.OutgoingWebhook, error) {
+	return r.webhooks, nil
+}
+
+func (r *fakeOutgoingWebhookRepository) Delete(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (r *fakeOutgoingWebhookRepository) CreateDelivery(_ context.Context, delivery entity.WebhookDelivery) error {
+	r.deliveries <- delivery
+	return nil
+}
+
+func (r *fakeOutgoingWebhookRepository) ListDeliveries(context.Context, string, string, int) ([]*entity.WebhookDelivery, error) {
+	return nil, nil
+}
+
+type receivedRequest struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+}
+
+// newReceiver answers with the statuses in turn and records the requests it gets.
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, func() []receivedRequest) {
+	var mu sync.Mutex
+	var received []receivedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedRequest{at: time.Now(), header: r.Header.Clone(), body: body})
+		status := statuses[min(len(received), len(statuses))-1]
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedRequest(nil), received...)
+	}
+}
+
+func waitForDeliveries(t *testing.T, repo *fakeOutgoingWebhookRepository, n int) []entity.WebhookDelivery {
+	var deliveries []entity.WebhookDelivery
+	for len(deliveries) < n {
+		select {
+		case delivery := <-repo.deliveries:
+			deliveries = append(deliveries, delivery)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d deliveries, want %d", len(deliveries), n)
+		}
+	}
+	return deliveries
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	const initialBackoff = 50 * time.Millisecond
+	srv, received := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK)
+	repo := &fakeOutgoingWebhookRepository{
+		webhooks: []*entity.OutgoingWebhook{
+			{ID: "hook", RoomID: "room", URL: srv.URL, Secret: "secret", Events: []string{"message"}},
+		},
+		deliveries: make(chan entity.WebhookDelivery, 10),
+	}
+	d := NewWebhookDispatcher(repo, srv.Client(), initialBackoff)
+
+	d.Dispatch(context.Background(), "room", "message", map[string]string{"content": "hello"})
+
+	deliveries := waitForDeliveries(t, repo, 3)
+	for i, delivery := range deliveries {
+		if delivery.Attempt != i+1 {
+			t.Errorf("delivery %d: attempt = %d, want %d", i, delivery.Attempt, i+1)
+		}
+		if want := i == 2; delivery.Succeeded != want {
+			t.Errorf("delivery %d: succeeded = %v, want %v", i, delivery.Succeeded, want)
+		}
+	}
+	if deliveries[0].StatusCode != http.StatusInternalServerError || deliveries[2].StatusCode != http.StatusOK {
+		t.Errorf("status codes = %d, %d, %d", deliveries[0].StatusCode, deliveries[1].StatusCode, deliveries[2].StatusCode)
+	}
+
+	requests := received()
+	if len(requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(requests))
+	}
+	if gap := requests[1].at.Sub(requests[0].at); gap < initialBackoff {
+		t.Errorf("first retry after %v, want at least %v", gap, initialBackoff)
+	}
+	if gap := requests[2].at.Sub(requests[1].at); gap < 2*initialBackoff {
+		t.Errorf("second retry after %v, want at least %v", gap, 2*initialBackoff)
+	}
+
+	eventID := requests[0].header.Get(EventIDHeader)
+	for i, req := range requests {
+		if got := req.header.Get(EventIDHeader); got != eventID {
+			t.Errorf("request %d: event ID = %q, want %q across retries", i, got, eventID)
+		}
+		if got := req.header.Get(EventHeader); got != "message" {
+			t.Errorf("request %d: event = %q, want message", i, got)
+		}
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(req.header.Get(TimestampHeader) + "." + string(req.body)))
+		if got, want := req.header.Get(SignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("request %d: signature = %q, want %q", i, got, want)
+		}
+	}
+
+	var event entity.WebhookEvent
+	if err := json.Unmarshal(requests[0].body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != eventID || event.Event != "message" || event.RoomID != "room" {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestDispatchDoesNotRetryClientErrors(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusBadRequest, http.StatusOK)
+	repo := &fakeOutgoingWebhookRepository{
+		webhooks: []*entity.OutgoingWebhook{
+			{ID: "hook", RoomID: "room", URL: srv.URL, Secret: "secret", Events: []string{"message"}},
+		},
+		deliveries: make(chan entity.WebhookDelivery, 10),
+	}
+	d := NewWebhookDispatcher(repo, srv.Client(), time.Millisecond)
+
+	d.Dispatch(context.Background(), "room", "message", nil)
+
+	deliveries := waitForDeliveries(t, repo, 1)
+	if deliveries[0].Succeeded || deliveries[0].StatusCode != http.StatusBadRequest {
+		t.Errorf("delivery = %+v", deliveries[0])
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(received()); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestDispatchSkipsUnsubscribedEvents(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusOK)
+	repo := &fakeOutgoingWebhookRepository{
+		webhooks: []*entity.OutgoingWebhook{
+			{ID: "hook", RoomID: "room", URL: srv.URL, Secret: "secret", Events: []string{"join"}},
+		},
+		deliveries: make(chan entity.WebhookDelivery, 10),
+	}
+	d := NewWebhookDispatcher(repo, srv.Client(), time.Millisecond)
+
+	d.Dispatch(context.Background(), "room", "message", nil)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := len(received()); n != 0 {
+		t.Errorf("got %d requests, want 0", n)
+	}
+}
+
+func TestNewClientRefusesLoopback(t *testing.T) {
+	srv, received := newReceiver(t, http.StatusOK)
+
+	resp, err := NewClient().Post(srv.URL, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("posted to a loopback address")
+	}
+	if !errors.Is(err, ErrNonPublicAddress) {
+		t.Errorf("err = %v, want %v", err, ErrNonPublicAddress)
+	}
+	if n := len(received()); n != 0 {
+		t.Errorf("got %d requests, want 0", n)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
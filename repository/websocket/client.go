@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/tusmasoma/simple-chat/config"
 	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/markdown"
+	"github.com/tusmasoma/simple-chat/internal/mention"
 	"github.com/tusmasoma/simple-chat/repository"
 )
 
@@ -18,22 +23,29 @@ var (
 )
 
 type Client struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
+	ID string `json:"id"`
+	// name changes with /nick and is read by the hub and room goroutines; use GetName.
+	name       string
+	nameMu     sync.RWMutex
 	hub        *Hub
 	rooms      map[*Room]bool
 	conn       *websocket.Conn
 	send       chan []byte
 	pubsubRepo repository.PubSubRepository
+	// calls queues work from other goroutines for the read goroutine, which owns rooms.
+	calls      []func()
+	callsMu    sync.Mutex
+	callsReady chan struct{}
 }
 
 func NewClientWebSocketRepository(conn *websocket.Conn, hub *Hub, name string, id string, pubsubRepo repository.PubSubRepository) repository.ClientWebSocketRepository {
 	return &Client{
 		ID:         id,
-		Name:       name,
+		name:       name,
 		conn:       conn,
 		hub:        hub,
 		pubsubRepo: pubsubRepo,
+		callsReady: make(chan struct{}, 1),
 	}
 }
 
@@ -46,19 +58,71 @@ func (client *Client) ReadPump() {
 	client.conn.SetReadDeadline(time.Now().Add(config.PongWait))
 	client.conn.SetPongHandler(func(string) error { client.conn.SetReadDeadline(time.Now().Add(config.PongWait)); return nil })
 
-	// Start endless read loop, waiting for messages from client
+	messages := make(chan []byte)
+	go client.readMessages(messages)
+
+	for {
+		select {
+		case jsonMessage, ok := <-messages:
+			if !ok {
+				return
+			}
+			client.handleNewMessage(jsonMessage)
+
+		case <-client.callsReady:
+			client.runCalls()
+		}
+	}
+}
+
+// Start endless read loop, waiting for messages from client
+func (client *Client) readMessages(messages chan<- []byte) {
+	defer close(messages)
 	for {
 		_, jsonMessage, err := client.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("unexpected close error: %v", err)
 			}
-			break
+			return
 		}
+		messages <- jsonMessage
+	}
+}
+
+func (client *Client) GetName() string {
+	client.nameMu.RLock()
+	defer client.nameMu.RUnlock()
+	return client.name
+}
 
-		client.handleNewMessage(jsonMessage)
+func (client *Client) setName(name string) {
+	client.nameMu.Lock()
+	defer client.nameMu.Unlock()
+	client.name = name
+}
+
+// Queue fn to run on the read goroutine of the client, in order and without waiting for it
+func (client *Client) post(fn func()) {
+	client.callsMu.Lock()
+	client.calls = append(client.calls, fn)
+	client.callsMu.Unlock()
+
+	select {
+	case client.callsReady <- struct{}{}:
+	default:
 	}
+}
 
+func (client *Client) runCalls() {
+	client.callsMu.Lock()
+	calls := client.calls
+	client.calls = nil
+	client.callsMu.Unlock()
+
+	for _, fn := range calls {
+		fn()
+	}
 }
 
 func (client *Client) WritePump() {
@@ -123,81 +187,358 @@ func (client *Client) handleNewMessage(jsonMessage []byte) {
 
 	switch message.Action {
 	case config.SendMessageAction:
-		roomID := message.TargetID
-		if room := client.hub.findRoomByID(roomID); room != nil {
-			room.broadcast <- &message
+		if isCommand(message.Content) {
+			client.handleCommand(message)
+			return
 		}
+		// A leading "//" escapes a message that starts with a slash.
+		message.Content = strings.TrimPrefix(message.Content, "/")
+		client.handleSendMessage(message)
 	case config.JoinRoomAction:
 		client.handleJoinRoomMessage(message)
 	case config.LeaveRoomAction:
 		client.handleLeaveRoomMessage(message)
 	case config.JoinRoomPrivateAction:
-		client.handleJoinRoomMessage(message)
+		client.handleJoinRoomPrivateMessage(message)
+	case config.EditMessageAction:
+		client.handleEditMessage(message)
+	case config.DeleteMessageAction:
+		client.handleDeleteMessage(message)
+	case config.AddReactionAction, config.RemoveReactionAction:
+		client.handleReactionMessage(message)
+	case config.MarkReadAction:
+		client.handleMarkReadMessage(message)
+	case config.TypingAction, config.StopTypingAction:
+		client.handleTypingMessage(message)
+	case config.PinMessageAction, config.UnpinMessageAction:
+		client.handlePinMessage(message)
+	case config.ScheduleMessageAction:
+		client.handleScheduleMessage(message)
 	}
 }
 
-func (client *Client) handleJoinRoomMessage(message entity.Message) {
-	roomName := message.Content
+func (client *Client) handleSendMessage(received entity.Message) {
+	// Only these fields are taken from the client; the server fills in everything else.
+	message := entity.Message{
+		Action:   config.SendMessageAction,
+		TargetID: received.TargetID,
+		SenderID: client.ID,
+		Content:  received.Content,
+		ParentID: received.ParentID,
+		Nonce:    received.Nonce,
+	}
+
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	if len(message.Nonce) > config.MaxNonceSize {
+		client.notifyError(message, config.ErrInvalidNonce)
+		return
+	}
+	// A retry of a stored message is acknowledged before anything is checked again: the
+	// attachments it references were taken by the first attempt.
+	if message.Nonce != "" {
+		id, err := client.hub.nonceRepo.Get(context.Background(), client.ID, message.Nonce)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if id != "" {
+			ack := &entity.Message{
+				ID:       id,
+				Action:   config.AckAction,
+				TargetID: room.ID,
+				SenderID: client.ID,
+				Nonce:    message.Nonce,
+			}
+			client.send <- ack.Encode()
+			return
+		}
+	}
 
-	client.joinRoom(roomName, nil)
+	if !client.hub.resolveParent(&message, room) {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
+	}
+	if !client.resolveAttachments(&message, received.Attachments, room) {
+		client.notifyError(message, config.ErrInvalidAttachment)
+		return
+	}
+	message.Mentions = mention.Resolve(context.Background(), client.hub.userRepo, message.Content, client.ID)
+
+	if err := stampMessage(&message); err != nil {
+		log.Println(err)
+		return
+	}
+	message.HTML = markdown.Render(message.Content)
+	room.broadcast <- &message
 }
 
-func (client *Client) handleLeaveRoomMessage(message entity.Message) {
-	room := client.hub.findRoomByID(message.Content)
-	if room == nil {
+// Check that the parent of a reply is a live message in the room. Threads are one level
+// deep: a reply to a reply joins the root thread.
+func (h *Hub) resolveParent(message *entity.Message, room *Room) bool {
+	if message.ParentID == "" {
+		return true
+	}
+	parent, err := h.messageRepo.Get(context.Background(), message.ParentID)
+	if err != nil || parent.TargetID != room.ID || parent.DeletedAt != nil {
+		return false
+	}
+	if parent.ParentID != "" {
+		message.ParentID = parent.ParentID
+	}
+	return true
+}
+
+// Set the attachments of the message to the stored attachments the client referenced.
+// Only unsent uploads of the sender to the same room may be referenced.
+func (client *Client) resolveAttachments(message *entity.Message, refs []*entity.Attachment, room *Room) bool {
+	if len(refs) > config.MaxAttachmentsPerMessage {
+		return false
+	}
+
+	attachments := make([]*entity.Attachment, 0, len(refs))
+	for _, ref := range refs {
+		if ref == nil {
+			return false
+		}
+		attachment, err := client.hub.attachmentRepo.Get(context.Background(), ref.ID)
+		if err != nil || attachment.RoomID != room.ID || attachment.UploaderID != client.ID || attachment.MessageID != "" {
+			return false
+		}
+		attachments = append(attachments, attachment)
+	}
+	message.Attachments = attachments
+	return true
+}
+
+// Assign a server-generated, time-sortable ID and timestamp to the message.
+// Every node receives the same values through the pub/sub payload.
+func stampMessage(message *entity.Message) error {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	message.ID = id.String()
+	message.CreatedAt = time.Now().UTC()
+	return nil
+}
+
+func (client *Client) handleEditMessage(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
 		return
 	}
-	if _, ok := client.rooms[room]; ok {
-		delete(client.rooms, room)
+
+	stored, err := client.hub.messageRepo.Get(context.Background(), message.ID)
+	if err != nil || stored.TargetID != room.ID || stored.DeletedAt != nil {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
+	}
+	if stored.SenderID != client.ID {
+		client.notifyError(message, config.ErrNotMessageOwner)
+		return
 	}
 
-	room.unregister <- client
+	if strings.TrimSpace(message.Content) == "" {
+		client.notifyError(message, config.ErrEmptyMessage)
+		return
+	}
+
+	// Everything but the content comes from storage, not from the client.
+	editedAt := time.Now().UTC()
+	edited := *stored
+	edited.Action = config.EditMessageAction
+	edited.Content = message.Content
+	edited.EditedAt = &editedAt
+	edited.HTML = markdown.Render(edited.Content)
+	room.broadcast <- &edited
+}
+
+func (client *Client) handleDeleteMessage(message entity.Message) {
+	ctx := context.Background()
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	stored, err := client.hub.messageRepo.Get(ctx, message.ID)
+	if err != nil || stored.TargetID != room.ID || stored.DeletedAt != nil {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
+	}
+	if stored.SenderID != client.ID {
+		isModerator, err := client.hub.roomRepo.IsModerator(ctx, room.ID, client.ID)
+		if err != nil || !isModerator {
+			client.notifyError(message, config.ErrNotMessageModerator)
+			return
+		}
+	}
+
+	// The tombstone carries no content; SenderID is the user who redacted the message.
+	deletedAt := time.Now().UTC()
+	message.Content = ""
+	message.CreatedAt = stored.CreatedAt
+	message.DeletedAt = &deletedAt
+	room.broadcast <- &message
 }
 
-func (client *Client) handleJoinRoomPrivateMessage(message entity.Message) {
-	target := client.hub.findClientByID(message.Content)
-	if target == nil {
+func (client *Client) handleReactionMessage(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
 		return
 	}
 
-	roomName := message.Content + client.ID
+	if message.Content == "" || len(message.Content) > config.MaxReactionSize {
+		client.notifyError(message, config.ErrInvalidReaction)
+		return
+	}
 
-	joinedRoom := client.joinRoom(roomName, target)
-	if joinedRoom != nil {
-		client.inviteTargetUser(target, joinedRoom)
+	stored, err := client.hub.messageRepo.Get(context.Background(), message.ID)
+	if err != nil || stored.TargetID != room.ID || stored.DeletedAt != nil {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
 	}
+
+	message.CreatedAt = time.Now().UTC()
+	room.broadcast <- &message
 }
 
-func (client *Client) joinRoom(roomName string, sender *Client) *Room {
-	room := client.hub.findRoomByName(roomName)
-	if room == nil {
-		room = client.hub.createRoom(roomName, sender != nil)
+func (client *Client) handleMarkReadMessage(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
 	}
 
-	if sender == nil && room.Private {
-		return nil
+	stored, err := client.hub.messageRepo.Get(context.Background(), message.ID)
+	if err != nil || stored.TargetID != room.ID {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
 	}
 
-	if !client.isInRoom(room) {
-		client.rooms[room] = true
-		room.register <- client
-		client.notifyRoomJoined(room, sender)
+	message.Content = ""
+	message.CreatedAt = time.Now().UTC()
+	room.broadcast <- &message
+}
+
+func (client *Client) handlePinMessage(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
 	}
-	return room
+
+	stored, err := client.hub.messageRepo.Get(context.Background(), message.ID)
+	if err != nil || stored.TargetID != room.ID || (message.Action == config.PinMessageAction && stored.DeletedAt != nil) {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
+	}
+
+	message.Content = ""
+	message.CreatedAt = time.Now().UTC()
+	room.broadcast <- &message
 }
 
-// Send out invite message over pub/sub in the general channel
-func (client *Client) inviteTargetUser(target *Client, room *Room) {
-	inviteMessage := &entity.Message{
-		Action:   config.JoinRoomPrivateAction,
-		Content:  target.ID,
+func (client *Client) handleTypingMessage(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	room.broadcast <- &entity.Message{
+		Action:   message.Action,
 		TargetID: room.ID,
 		SenderID: client.ID,
 	}
+}
 
-	if err := client.pubsubRepo.Publish(context.Background(), config.PubSubGeneralChannel, inviteMessage.Encode()); err != nil {
-		log.Print(err)
+func (client *Client) handleJoinRoomMessage(message entity.Message) {
+	roomName := message.Content
+	// Direct message rooms are opened with join_room_private.
+	if strings.HasPrefix(roomName, entity.DirectRoomPrefix) {
+		return
 	}
+
+	client.joinRoom(roomName, nil, message.LastMessageID)
+}
+
+func (client *Client) handleLeaveRoomMessage(message entity.Message) {
+	room := client.findRoom(message.Content)
+	if room == nil {
+		return
+	}
+	if _, ok := client.rooms[room]; ok {
+		delete(client.rooms, room)
+	}
+	// A direct conversation stays with both users; leaving only stops delivery to this connection.
+	if !room.Direct {
+		if err := client.hub.roomRepo.RemoveMember(context.Background(), room.ID, client.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	room.unregister <- client
+}
+
+// joinRoom enters the room with the name, creating it if it does not exist yet.
+func (client *Client) joinRoom(roomName string, sender *Client, lastMessageID string) *Room {
+	var room *Room
+	created := false
+	client.hub.call(func() {
+		room = client.hub.findRoomByName(roomName)
+		if room == nil {
+			room = client.hub.createRoom(roomName, sender != nil)
+			created = true
+		}
+	})
+	// The user who creates a room moderates it.
+	if created {
+		if err := client.hub.roomRepo.AddModerator(context.Background(), room.ID, client.ID); err != nil {
+			log.Println(err)
+		}
+	}
+
+	// Private rooms are entered by their members only, whoever invited them and from whichever node.
+	if room.Private && !created {
+		isMember, err := client.hub.roomRepo.IsMember(context.Background(), room.ID, client.ID)
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		if !isMember {
+			return nil
+		}
+	}
+
+	client.enterRoom(room, sender, lastMessageID)
+	return room
+}
+
+// enterRoom registers the client in the room. A non-empty lastMessageID makes the room
+// replay every message stored after it before live delivery starts.
+func (client *Client) enterRoom(room *Room, sender *Client, lastMessageID string) {
+	if !client.isInRoom(room) {
+		if err := client.hub.roomRepo.AddMember(context.Background(), room.ID, client.ID); err != nil {
+			log.Println(err)
+		}
+		client.rooms[room] = true
+		client.notifyRoomJoined(room, sender)
+		if lastMessageID != "" {
+			room.resume <- &resumeRequest{client: client, lastMessageID: lastMessageID}
+		} else {
+			room.register <- client
+		}
+	}
+}
+
+// Find the room running on this node through the hub, which owns the rooms
+func (client *Client) findRoom(id string) *Room {
+	var room *Room
+	client.hub.call(func() {
+		room = client.hub.findRoomByID(id)
+	})
+	return room
 }
 
 func (client *Client) isInRoom(room *Room) bool {
@@ -207,12 +548,27 @@ func (client *Client) isInRoom(room *Room) bool {
 	return false
 }
 
+// sender is the user who invited the client, if any. Inviters on other nodes are unknown here.
 func (client *Client) notifyRoomJoined(room *Room, sender *Client) {
 	message := entity.Message{
 		Action:   config.RoomJoinedAction,
 		TargetID: room.ID,
-		SenderID: sender.ID,
+	}
+	if sender != nil {
+		message.SenderID = sender.ID
 	}
 
 	client.send <- message.Encode()
 }
+
+// Reply to the client that the action in message was rejected
+func (client *Client) notifyError(message entity.Message, reason string) {
+	errorMessage := entity.Message{
+		ID:       message.ID,
+		Action:   config.ErrorAction,
+		Content:  reason,
+		TargetID: message.TargetID,
+	}
+
+	client.send <- errorMessage.Encode()
+}
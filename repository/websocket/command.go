@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/markdown"
+)
+
+// command is a slash command typed into send_message. It runs in the room the message
+// was sent to and either replies privately to the caller or acts on the room.
+type command struct {
+	usage       string
+	description string
+	run         func(client *Client, room *Room, message entity.Message, args string)
+}
+
+var commands = make(map[string]*command)
+
+// User names must stay resolvable as @name mentions.
+var userNamePattern = regexp.MustCompile(`^[\w.\-]+$`)
+
+func registerCommand(name string, usage string, description string, run func(client *Client, room *Room, message entity.Message, args string)) {
+	commands[name] = &command{
+		usage:       usage,
+		description: description,
+		run:         run,
+	}
+}
+
+func init() {
+	registerCommand("me", "/me <action>", "Describe what you are doing", runMeCommand)
+	registerCommand("topic", "/topic [text]", "Show the room topic, or set it if you moderate the room", runTopicCommand)
+	registerCommand("nick", "/nick <name>", "Change your name", runNickCommand)
+	registerCommand("invite", "/invite <name>", "Add a user to the room", runInviteCommand)
+	registerCommand("leave", "/leave", "Leave the room", runLeaveCommand)
+	registerCommand("help", "/help", "List the commands", runHelpCommand)
+}
+
+// Content starting with a single slash is a command; "//" sends the rest with one slash.
+func isCommand(content string) bool {
+	return strings.HasPrefix(content, "/") && !strings.HasPrefix(content, "//")
+}
+
+func (client *Client) handleCommand(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	name, args, _ := strings.Cut(strings.TrimPrefix(message.Content, "/"), " ")
+	cmd, ok := commands[strings.ToLower(name)]
+	if !ok {
+		client.notifyError(message, config.ErrUnknownCommand)
+		return
+	}
+	cmd.run(client, room, message, strings.TrimSpace(args))
+}
+
+// Reply to the caller only; the content is rendered as Markdown like a message
+func (client *Client) replyToCommand(room *Room, content string) {
+	reply := entity.Message{
+		Action:   config.CommandReplyAction,
+		Content:  content,
+		HTML:     markdown.Render(content),
+		TargetID: room.ID,
+	}
+
+	client.send <- reply.Encode()
+}
+
+func runMeCommand(client *Client, room *Room, message entity.Message, args string) {
+	if args == "" {
+		client.replyToCommand(room, "Usage: `/me <action>`")
+		return
+	}
+	message.Content = fmt.Sprintf("*%s %s*", client.GetName(), args)
+	client.handleSendMessage(message)
+}
+
+func runTopicCommand(client *Client, room *Room, message entity.Message, args string) {
+	ctx := context.Background()
+	if args == "" {
+		roomEntity, err := client.hub.roomRepo.GetByID(ctx, room.ID)
+		if err != nil {
+			return
+		}
+		if roomEntity.Topic == "" {
+			client.replyToCommand(room, "This room has no topic.")
+		} else {
+			client.replyToCommand(room, "Topic: "+roomEntity.Topic)
+		}
+		return
+	}
+
+	if len(args) > config.MaxTopicSize {
+		client.replyToCommand(room, fmt.Sprintf("Topics are limited to %d bytes.", config.MaxTopicSize))
+		return
+	}
+	isModerator, err := client.hub.roomRepo.IsModerator(ctx, room.ID, client.ID)
+	if err != nil {
+		return
+	}
+	if !isModerator {
+		client.replyToCommand(room, "Only room moderators can set the topic.")
+		return
+	}
+
+	message.Action = config.TopicChangedAction
+	message.Content = args
+	message.HTML = markdown.Render(args)
+	room.broadcast <- &message
+}
+
+func runNickCommand(client *Client, room *Room, _ entity.Message, args string) {
+	ctx := context.Background()
+	if args == "" || len(args) > config.MaxUserNameSize || !userNamePattern.MatchString(args) {
+		client.replyToCommand(room, fmt.Sprintf(
+			"Usage: `/nick <name>`. Names are up to %d letters, digits, `.`, `-` or `_`.", config.MaxUserNameSize,
+		))
+		return
+	}
+
+	user, err := client.hub.userRepo.GetByName(ctx, args)
+	if err == nil && user.ID != client.ID {
+		client.replyToCommand(room, "That name is taken.")
+		return
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err = client.hub.userRepo.UpdateName(ctx, client.ID, args); err != nil {
+		return
+	}
+
+	// Every connection of the user on this node picks up the new name.
+	client.hub.call(func() {
+		for _, c := range client.hub.findClientsByID(client.ID) {
+			c.setName(args)
+		}
+	})
+	client.replyToCommand(room, "You are now known as "+args+".")
+}
+
+func runInviteCommand(client *Client, room *Room, _ entity.Message, args string) {
+	ctx := context.Background()
+	if room.Direct {
+		client.replyToCommand(room, "Direct messages are between two people.")
+		return
+	}
+	if args == "" {
+		client.replyToCommand(room, "Usage: `/invite <name>`")
+		return
+	}
+
+	user, err := client.hub.userRepo.GetByName(ctx, strings.TrimPrefix(args, "@"))
+	if errors.Is(err, sql.ErrNoRows) {
+		client.replyToCommand(room, "No user is called "+args+".")
+		return
+	} else if err != nil {
+		return
+	}
+	if err = client.hub.roomRepo.AddMember(ctx, room.ID, user.ID); err != nil {
+		return
+	}
+
+	// The invited user's connections join the room on whichever node they are.
+	invite := &entity.Message{
+		Action:   config.JoinRoomPrivateAction,
+		Content:  user.ID,
+		TargetID: room.ID,
+		SenderID: client.ID,
+	}
+	if err = client.pubsubRepo.Publish(ctx, config.PubSubGeneralChannel, invite.Encode()); err != nil {
+		log.Print(err)
+		return
+	}
+	client.replyToCommand(room, "Invited "+user.Name+".")
+}
+
+func runLeaveCommand(client *Client, room *Room, message entity.Message, _ string) {
+	message.Content = room.ID
+	client.handleLeaveRoomMessage(message)
+}
+
+func runHelpCommand(client *Client, room *Room, _ entity.Message, _ string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = fmt.Sprintf("- `%s` %s", commands[name].usage, commands[name].description)
+	}
+	client.replyToCommand(room, strings.Join(lines, "\n"))
+}
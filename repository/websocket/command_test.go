@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type fakeUserRepository struct {
+	repository.UserRepository
+}
+
+func (fakeUserRepository) GetByName(context.Context, string) (*entity.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (fakeUserRepository) UpdateName(context.Context, string, string) error {
+	return nil
+}
+
+type fakeWebhookDispatcher struct{}
+
+func (fakeWebhookDispatcher) Dispatch(context.Context, string, string, any) {}
+
+// Run with -race: /nick renames the user while the hub and the room read the name.
+func TestNickWhileJoiningAndLeaving(t *testing.T) {
+	const renames = 100
+	hub := &Hub{
+		clients:  make(map[*Client]bool),
+		calls:    make(chan func()),
+		userRepo: fakeUserRepository{},
+	}
+	room := &Room{
+		ID:                "room",
+		clients:           make(map[*Client]bool),
+		typing:            make(map[string]*typingState),
+		webhookDispatcher: fakeWebhookDispatcher{},
+	}
+	client := &Client{
+		ID:         "user",
+		name:       "before",
+		hub:        hub,
+		send:       make(chan []byte, 16),
+		callsReady: make(chan struct{}, 1),
+	}
+	// Another connection in the room receives the welcome messages.
+	other := &Client{ID: "other", send: make(chan []byte, 16)}
+	hub.clients[client] = true
+	hub.clients[other] = true
+	room.clients[other] = true
+
+	// The hub and the receivers stop after the joining goroutine, which waits on them.
+	done, stop := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case call := <-hub.calls:
+				call()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for _, c := range []*Client{client, other} {
+		go func(c *Client) {
+			defer wg.Done()
+			for {
+				select {
+				case <-c.send:
+				case <-stop:
+					return
+				}
+			}
+		}(c)
+	}
+	joined := make(chan struct{})
+	go func() {
+		defer close(joined)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			room.registerClientInRoom(client)
+			room.unregisterClientInRoom(client)
+			hub.call(func() {
+				hub.notifyClientJoined(client)
+				hub.notifyClientLeft(client)
+			})
+		}
+	}()
+
+	for i := 0; i < renames; i++ {
+		runNickCommand(client, room, entity.Message{}, fmt.Sprintf("name%d", i))
+	}
+	close(done)
+	<-joined
+	close(stop)
+	wg.Wait()
+
+	if got, want := client.GetName(), fmt.Sprintf("name%d", renames-1); got != want {
+		t.Errorf("name = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+// Direct message rooms get name-based UUIDs in this namespace, so that every node
+// agrees on the room of a pair of users without coordinating. Anyone can derive the
+// ID of a pair, so it grants nothing: reads are gated on room_members like any room.
+var directRoomNamespace = uuid.MustParse("5b0a8f3e-1c7d-4e2a-9f61-3d8c2b7e4a10")
+
+// Open the direct message room with the user in message.Content, creating it the first
+// time either user opens it. The other user joins it with the first message sent.
+func (client *Client) handleJoinRoomPrivateMessage(message entity.Message) {
+	ctx := context.Background()
+	peerID := message.Content
+	if _, err := client.hub.userRepo.Get(ctx, peerID); err != nil {
+		client.notifyError(message, config.ErrUserNotFound)
+		return
+	}
+
+	var room *Room
+	client.hub.call(func() {
+		room = client.hub.findOrRunDirectRoom(ctx, client.ID, peerID)
+	})
+	if room == nil {
+		return
+	}
+	client.enterRoom(room, nil, message.LastMessageID)
+}
+
+func (h *Hub) findOrRunDirectRoom(ctx context.Context, userID string, peerID string) *Room {
+	name := entity.DirectRoomName(userID, peerID)
+	id := uuid.NewSHA1(directRoomNamespace, []byte(name)).String()
+
+	room := h.findOrRunRoomByID(ctx, id)
+	if room == nil {
+		room = h.createDirectRoom(ctx, id, name)
+	}
+	if room == nil || !room.Direct || room.Name != name {
+		return nil
+	}
+	for _, memberID := range []string{userID, peerID} {
+		if err := h.roomRepo.AddMember(ctx, room.ID, memberID); err != nil {
+			log.Println(err)
+			return nil
+		}
+	}
+	return room
+}
+
+func (h *Hub) createDirectRoom(ctx context.Context, id string, name string) *Room {
+	err := h.roomRepo.Create(ctx, entity.Room{
+		ID:      id,
+		Name:    name,
+		Private: true,
+		Direct:  true,
+	})
+	if err != nil {
+		// Another node may have created it first.
+		return h.findOrRunRoomByID(ctx, id)
+	}
+
+	room := NewRoom(name, true, h.pubsubRepo, h.roomRepo, h.messageRepo, h.reactionRepo, h.readCursorRepo, h.nonceRepo, h.attachmentRepo, h.webhookDispatcher)
+	room.ID = id
+	room.Direct = true
+
+	go room.Run()
+	h.rooms[room] = true
+	return room
+}
+
+// Send out the message over pub/sub in the general channel so that the other user
+// gets it on any node, even before they opened the conversation
+func (room *Room) publishDirectMessage(ctx context.Context, message *entity.Message) {
+	notification := *message
+	notification.Action = config.DirectMessageAction
+	notification.Nonce = ""
+
+	if err := room.pubsubRepo.Publish(ctx, config.PubSubGeneralChannel, notification.Encode()); err != nil {
+		log.Print(err)
+	}
+}
+
+// Deliver a direct message to the connections of its recipient on this node that are
+// not in the room yet, and make them join it. Runs on the hub goroutine, which hands
+// the join to the goroutine of each connection.
+func (h *Hub) handleDirectMessage(message entity.Message) {
+	room := h.findOrRunRoomByID(context.Background(), message.TargetID)
+	if room == nil || !room.Direct {
+		return
+	}
+	recipientID := entity.DirectRoomPeer(room.Name, message.SenderID)
+	if recipientID == "" {
+		return
+	}
+	isMember, err := h.roomRepo.IsMember(context.Background(), room.ID, recipientID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !isMember {
+		return
+	}
+
+	message.Action = config.SendMessageAction
+	payload := message.Encode()
+	sender := h.findClientByID(message.SenderID)
+	for _, client := range h.findClientsByID(recipientID) {
+		client := client
+		client.post(func() {
+			client.receiveDirectMessage(room, sender, payload, message.ID)
+		})
+	}
+}
+
+// The room replays anything sent after the message before live delivery starts, so
+// nothing is missed or delivered twice while the client joins.
+func (client *Client) receiveDirectMessage(room *Room, sender *Client, payload []byte, messageID string) {
+	if client.isInRoom(room) {
+		return
+	}
+	client.rooms[room] = true
+	client.notifyRoomJoined(room, sender)
+	client.send <- payload
+	room.resume <- &resumeRequest{client: client, lastMessageID: messageID}
+}
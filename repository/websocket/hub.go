@@ -12,28 +12,46 @@ import (
 )
 
 type Hub struct {
-	clients    map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan []byte
-	rooms      map[*Room]bool
-	roomRepo   repository.RoomRepository
-	userRepo   repository.UserRepository
-	pubsubRepo repository.PubSubRepository
-	users      []*entity.User
+	clients              map[*Client]bool
+	register             chan *Client
+	unregister           chan *Client
+	broadcast            chan []byte
+	calls                chan func()
+	rooms                map[*Room]bool
+	roomRepo             repository.RoomRepository
+	userRepo             repository.UserRepository
+	pubsubRepo           repository.PubSubRepository
+	messageRepo          repository.MessageRepository
+	reactionRepo         repository.ReactionRepository
+	readCursorRepo       repository.ReadCursorRepository
+	nonceRepo            repository.NonceRepository
+	attachmentRepo       repository.AttachmentRepository
+	scheduledMessageRepo repository.ScheduledMessageRepository
+	lockRepo             repository.LockRepository
+	webhookDispatcher    repository.WebhookDispatcher
+	users                []*entity.User
 }
 
 // NewWebsocketServer creates a new WsServer type
-func NewHubWebSocketRepository(ctx context.Context, roomRepo repository.RoomRepository, userRepo repository.UserRepository, pubsubRepo repository.PubSubRepository) repository.HubWebSocketRepository {
+func NewHubWebSocketRepository(ctx context.Context, roomRepo repository.RoomRepository, userRepo repository.UserRepository, pubsubRepo repository.PubSubRepository, messageRepo repository.MessageRepository, reactionRepo repository.ReactionRepository, readCursorRepo repository.ReadCursorRepository, nonceRepo repository.NonceRepository, attachmentRepo repository.AttachmentRepository, scheduledMessageRepo repository.ScheduledMessageRepository, lockRepo repository.LockRepository, webhookDispatcher repository.WebhookDispatcher) repository.HubWebSocketRepository {
 	hub := &Hub{
-		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan []byte),
-		rooms:      make(map[*Room]bool),
-		roomRepo:   roomRepo,
-		userRepo:   userRepo,
-		pubsubRepo: pubsubRepo,
+		clients:              make(map[*Client]bool),
+		register:             make(chan *Client),
+		unregister:           make(chan *Client),
+		broadcast:            make(chan []byte),
+		calls:                make(chan func()),
+		rooms:                make(map[*Room]bool),
+		roomRepo:             roomRepo,
+		userRepo:             userRepo,
+		pubsubRepo:           pubsubRepo,
+		messageRepo:          messageRepo,
+		reactionRepo:         reactionRepo,
+		readCursorRepo:       readCursorRepo,
+		nonceRepo:            nonceRepo,
+		attachmentRepo:       attachmentRepo,
+		scheduledMessageRepo: scheduledMessageRepo,
+		lockRepo:             lockRepo,
+		webhookDispatcher:    webhookDispatcher,
 	}
 
 	hub.users, _ = userRepo.List(ctx)
@@ -44,6 +62,7 @@ func NewHubWebSocketRepository(ctx context.Context, roomRepo repository.RoomRepo
 // Run starts the server and listens for incoming messages
 func (h *Hub) Run() {
 	go h.listenPubSubChannel()
+	go h.runScheduler(context.Background())
 
 	for {
 		select {
@@ -56,17 +75,30 @@ func (h *Hub) Run() {
 
 		case message := <-h.broadcast:
 			h.broadcastToClients(message)
+
+		case call := <-h.calls:
+			call()
 		}
 
 	}
 }
 
+// Run fn on the hub goroutine, which owns the rooms, and wait for it to return
+func (h *Hub) call(fn func()) {
+	done := make(chan struct{})
+	h.calls <- func() {
+		defer close(done)
+		fn()
+	}
+	<-done
+}
+
 func (h *Hub) registerClient(client *Client) {
 	h.userRepo.Create(
 		context.Background(),
 		entity.User{
 			ID:   client.ID,
-			Name: client.Name,
+			Name: client.GetName(),
 		},
 	)
 
@@ -93,7 +125,7 @@ func (h *Hub) broadcastToClients(message []byte) {
 func (h *Hub) publishClientJoined(ctx context.Context, client *Client) error {
 	if err := h.userRepo.Create(ctx, entity.User{
 		ID:   client.ID,
-		Name: client.Name,
+		Name: client.GetName(),
 	}); err != nil {
 		log.Println(err)
 		return err
@@ -128,6 +160,8 @@ func (h *Hub) publishClientLeft(ctx context.Context, client *Client) error {
 	return nil
 }
 
+// The rooms running on this node are only read and written on the hub goroutine; other
+// goroutines go through h.call.
 func (h *Hub) findRoomByName(name string) *Room {
 	var foundRoom *Room
 	for room := range h.rooms {
@@ -148,8 +182,9 @@ func (h *Hub) runRoomFromRepository(name string) *Room {
 	var room *Room
 	roomEntity, _ := h.roomRepo.Get(context.Background(), name)
 	if roomEntity != nil {
-		room = NewRoom(roomEntity.Name, roomEntity.Private, h.pubsubRepo)
+		room = NewRoom(roomEntity.Name, roomEntity.Private, h.pubsubRepo, h.roomRepo, h.messageRepo, h.reactionRepo, h.readCursorRepo, h.nonceRepo, h.attachmentRepo, h.webhookDispatcher)
 		room.ID = roomEntity.ID
+		room.Direct = roomEntity.Direct
 
 		go room.Run()
 		h.rooms[room] = true
@@ -176,7 +211,7 @@ func (h *Hub) findClientByID(id string) *Client {
 }
 
 func (h *Hub) createRoom(name string, private bool) *Room {
-	room := NewRoom(name, private, h.pubsubRepo)
+	room := NewRoom(name, private, h.pubsubRepo, h.roomRepo, h.messageRepo, h.reactionRepo, h.readCursorRepo, h.nonceRepo, h.attachmentRepo, h.webhookDispatcher)
 
 	h.roomRepo.Create(context.Background(), entity.Room{
 		ID:      room.ID,
@@ -192,7 +227,7 @@ func (h *Hub) createRoom(name string, private bool) *Room {
 func (h *Hub) notifyClientJoined(client *Client) {
 	message := &entity.Message{
 		Action:   config.UserJoinedAction,
-		Content:  fmt.Sprintf(config.WelcomeMessage, client.Name),
+		Content:  fmt.Sprintf(config.WelcomeMessage, client.GetName()),
 		SenderID: client.ID,
 	}
 	h.broadcastToClients(message.Encode())
@@ -201,7 +236,7 @@ func (h *Hub) notifyClientJoined(client *Client) {
 func (h *Hub) notifyClientLeft(client *Client) {
 	message := &entity.Message{
 		Action:   config.UserLeftAction,
-		Content:  fmt.Sprintf(config.GoodbyeMessage, client.Name),
+		Content:  fmt.Sprintf(config.GoodbyeMessage, client.GetName()),
 		SenderID: client.ID,
 	}
 	h.broadcastToClients(message.Encode())
@@ -240,7 +275,17 @@ func (h *Hub) listenPubSubChannel() {
 		case config.UserLeftAction:
 			h.handleUserLeft(message)
 		case config.JoinRoomPrivateAction:
-			h.handleUserJoinPrivate(message)
+			h.call(func() {
+				h.handleUserJoinPrivate(message)
+			})
+		case config.MentionAction:
+			h.call(func() {
+				h.handleMention(message)
+			})
+		case config.DirectMessageAction:
+			h.call(func() {
+				h.handleDirectMessage(message)
+			})
 		}
 	}
 }
@@ -265,12 +310,35 @@ func (h *Hub) handleUserLeft(message entity.Message) {
 	h.broadcastToClients(message.Encode())
 }
 
+// Make the connections of the invited user on this node join the room. Runs on the hub
+// goroutine, which hands the join to the goroutine of each connection.
 func (h *Hub) handleUserJoinPrivate(message entity.Message) {
 	targetClients := h.findClientsByID(message.Content)
+	if len(targetClients) == 0 {
+		return
+	}
+	// The room may not be running on this node yet.
+	room := h.findOrRunRoomByID(context.Background(), message.TargetID)
+	if room == nil {
+		return
+	}
+	// The inviter is only known when connected to this node; joinRoom checks membership.
+	sender := h.findClientByID(message.SenderID)
 	for _, targetClient := range targetClients {
-		room := h.findRoomByID(message.TargetID)
-		client := h.findClientByID(message.SenderID)
-		targetClient.joinRoom(room.Name, client)
+		targetClient := targetClient
+		targetClient.post(func() {
+			targetClient.joinRoom(room.Name, sender, "")
+		})
+	}
+}
+
+// Deliver the mention to every connection of the mentioned users on this node. Runs on the hub goroutine.
+func (h *Hub) handleMention(message entity.Message) {
+	payload := message.Encode()
+	for _, userID := range message.Mentions {
+		for _, client := range h.findClientsByID(userID) {
+			client.send <- payload
+		}
 	}
 }
 
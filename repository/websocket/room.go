@@ -8,44 +8,93 @@ import (
 	"github.com/google/uuid"
 	"github.com/tusmasoma/simple-chat/config"
 	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/markdown"
+	"github.com/tusmasoma/simple-chat/internal/mention"
 	"github.com/tusmasoma/simple-chat/repository"
 )
 
 type Room struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	clients    map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *entity.Message
-	Private    bool `json:"private"`
-	pubsubRepo repository.PubSubRepository
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	clients           map[*Client]bool
+	register          chan *Client
+	resume            chan *resumeRequest
+	unregister        chan *Client
+	broadcast         chan *entity.Message
+	typing            map[string]*typingState
+	typingExpired     chan string
+	Private           bool `json:"private"`
+	Direct            bool `json:"direct"`
+	pubsubRepo        repository.PubSubRepository
+	roomRepo          repository.RoomRepository
+	messageRepo       repository.MessageRepository
+	reactionRepo      repository.ReactionRepository
+	readCursorRepo    repository.ReadCursorRepository
+	nonceRepo         repository.NonceRepository
+	attachmentRepo    repository.AttachmentRepository
+	webhookDispatcher repository.WebhookDispatcher
 }
 
-func NewRoom(name string, private bool, pubsub repository.PubSubRepository) *Room {
+// webhookUser is the data of join and leave events sent to outgoing webhooks.
+type webhookUser struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+}
+
+func newWebhookUser(client *Client) webhookUser {
+	return webhookUser{UserID: client.ID, UserName: client.GetName()}
+}
+
+// resumeRequest registers a reconnecting client after replaying what it missed.
+type resumeRequest struct {
+	client        *Client
+	lastMessageID string
+}
+
+func NewRoom(name string, private bool, pubsub repository.PubSubRepository, roomRepo repository.RoomRepository, messageRepo repository.MessageRepository, reactionRepo repository.ReactionRepository, readCursorRepo repository.ReadCursorRepository, nonceRepo repository.NonceRepository, attachmentRepo repository.AttachmentRepository, webhookDispatcher repository.WebhookDispatcher) *Room {
 	return &Room{
-		ID:         uuid.New().String(),
-		Name:       name,
-		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *entity.Message),
-		Private:    private,
-		pubsubRepo: pubsub,
+		ID:                uuid.New().String(),
+		Name:              name,
+		clients:           make(map[*Client]bool),
+		register:          make(chan *Client),
+		resume:            make(chan *resumeRequest),
+		unregister:        make(chan *Client),
+		broadcast:         make(chan *entity.Message),
+		typing:            make(map[string]*typingState),
+		typingExpired:     make(chan string),
+		Private:           private,
+		pubsubRepo:        pubsub,
+		roomRepo:          roomRepo,
+		messageRepo:       messageRepo,
+		reactionRepo:      reactionRepo,
+		readCursorRepo:    readCursorRepo,
+		nonceRepo:         nonceRepo,
+		attachmentRepo:    attachmentRepo,
+		webhookDispatcher: webhookDispatcher,
 	}
 }
 
 // NewRoom creates a new Room
-func NewRoomWebSocketRepository(name string, private bool, pubsubRepo repository.PubSubRepository) repository.RoomWebSocketRepository {
+func NewRoomWebSocketRepository(name string, private bool, pubsubRepo repository.PubSubRepository, roomRepo repository.RoomRepository, messageRepo repository.MessageRepository, reactionRepo repository.ReactionRepository, readCursorRepo repository.ReadCursorRepository, nonceRepo repository.NonceRepository, attachmentRepo repository.AttachmentRepository, webhookDispatcher repository.WebhookDispatcher) repository.RoomWebSocketRepository {
 	return &Room{
-		ID:         uuid.New().String(),
-		Name:       name,
-		Private:    private,
-		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *entity.Message),
-		pubsubRepo: pubsubRepo,
+		ID:                uuid.New().String(),
+		Name:              name,
+		Private:           private,
+		clients:           make(map[*Client]bool),
+		register:          make(chan *Client),
+		resume:            make(chan *resumeRequest),
+		unregister:        make(chan *Client),
+		broadcast:         make(chan *entity.Message),
+		typing:            make(map[string]*typingState),
+		typingExpired:     make(chan string),
+		pubsubRepo:        pubsubRepo,
+		roomRepo:          roomRepo,
+		messageRepo:       messageRepo,
+		reactionRepo:      reactionRepo,
+		readCursorRepo:    readCursorRepo,
+		nonceRepo:         nonceRepo,
+		attachmentRepo:    attachmentRepo,
+		webhookDispatcher: webhookDispatcher,
 	}
 }
 
@@ -60,11 +109,17 @@ func (room *Room) Run() {
 		case client := <-room.register:
 			room.registerClientInRoom(client)
 
+		case req := <-room.resume:
+			room.resumeClientInRoom(ctx, req.client, req.lastMessageID)
+
 		case client := <-room.unregister:
 			room.unregisterClientInRoom(client)
 
 		case message := <-room.broadcast:
-			room.publishRoomMessage(ctx, message.Encode())
+			room.handleRoomMessage(ctx, message)
+
+		case userID := <-room.typingExpired:
+			room.expireTyping(ctx, userID)
 		}
 	}
 }
@@ -74,24 +129,111 @@ func (room *Room) registerClientInRoom(client *Client) {
 		room.notifyClientJoined(client)
 	}
 	room.clients[client] = true
+	room.webhookDispatcher.Dispatch(context.Background(), room.ID, config.WebhookEventJoin, newWebhookUser(client))
+}
+
+// Replay the stored messages after lastMessageID, then switch the client to live delivery.
+// Messages stored between the replay and the registration are sent in a second pass, so a
+// message may be delivered twice around the switch; clients dedupe by message ID.
+func (room *Room) resumeClientInRoom(ctx context.Context, client *Client, lastMessageID string) {
+	lastMessageID = room.replayMessages(ctx, client, lastMessageID)
+	room.registerClientInRoom(client)
+	room.replayMessages(ctx, client, lastMessageID)
+}
+
+// Replay up to config.MaxResumeMessages of the latest messages after afterID. When more
+// were missed, the client is told with a history_truncated message first, and loads the
+// older ones from the history endpoint.
+func (room *Room) replayMessages(ctx context.Context, client *Client, afterID string) string {
+	// One more than replayed tells whether any were left out.
+	messages, err := room.messageRepo.ListLatestAfter(ctx, room.ID, afterID, config.MaxResumeMessages+1)
+	if err != nil {
+		log.Print(err)
+		return afterID
+	}
+	if len(messages) > config.MaxResumeMessages {
+		messages = messages[1:]
+		truncated := &entity.Message{
+			ID:       messages[0].ID,
+			Action:   config.HistoryTruncatedAction,
+			TargetID: room.ID,
+		}
+		client.send <- truncated.Encode()
+	}
+	if err = room.loadMessageDetails(ctx, messages); err != nil {
+		log.Print(err)
+		return afterID
+	}
+	for _, message := range messages {
+		client.send <- message.Encode()
+		afterID = message.ID
+	}
+	return afterID
+}
+
+// Fill in the rendering, reactions and attachments of stored messages, as the history endpoint does.
+func (room *Room) loadMessageDetails(ctx context.Context, messages []*entity.Message) error {
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	counts, err := room.reactionRepo.CountByMessageIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	attachments, err := room.attachmentRepo.ListByMessageIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		message.HTML = markdown.Render(message.Content)
+		message.Reactions = counts[message.ID]
+		// A redacted message takes its attachments with it.
+		if message.DeletedAt == nil {
+			message.Attachments = attachments[message.ID]
+		}
+	}
+	return nil
 }
 
 func (room *Room) unregisterClientInRoom(client *Client) {
 	if _, ok := room.clients[client]; ok {
 		delete(room.clients, client)
+		// The user may still be typing in another tab.
+		if !room.hasClientWithID(client.ID) {
+			room.stopTyping(context.Background(), client.ID)
+		}
+		room.webhookDispatcher.Dispatch(context.Background(), room.ID, config.WebhookEventLeave, newWebhookUser(client))
 	}
 }
 
+func (room *Room) hasClientWithID(id string) bool {
+	for client := range room.clients {
+		if client.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (room *Room) broadcastToClientsInRoom(message []byte) {
 	for client := range room.clients {
 		client.send <- message
 	}
 }
 
+func (room *Room) broadcastToOtherClientsInRoom(message []byte, senderID string) {
+	for client := range room.clients {
+		if client.ID != senderID {
+			client.send <- message
+		}
+	}
+}
+
 func (room *Room) notifyClientJoined(client *Client) {
 	message := &entity.Message{
 		Action:   config.SendMessageAction,
-		Content:  fmt.Sprintf(config.WelcomeMessage, client.Name),
+		Content:  fmt.Sprintf(config.WelcomeMessage, client.GetName()),
 		TargetID: room.ID,
 		SenderID: client.ID,
 	}
@@ -99,6 +241,139 @@ func (room *Room) notifyClientJoined(client *Client) {
 	room.broadcastToClientsInRoom(message.Encode())
 }
 
+// Persist the message or the change to it before it is published so that history never misses a delivered message
+func (room *Room) handleRoomMessage(ctx context.Context, message *entity.Message) {
+	var err error
+	switch message.Action {
+	case config.TypingAction, config.StopTypingAction:
+		room.handleTyping(ctx, message)
+		return
+	case config.SendMessageAction:
+		var stored bool
+		stored, err = room.storeMessage(ctx, message)
+		if err == nil && !stored {
+			return
+		}
+	case config.EditMessageAction:
+		var updated bool
+		updated, err = room.messageRepo.Update(ctx, *message)
+		// Redacted since the edit was sent.
+		if err == nil && !updated {
+			return
+		}
+	case config.DeleteMessageAction:
+		err = room.messageRepo.Redact(ctx, *message)
+	case config.AddReactionAction, config.RemoveReactionAction:
+		err = room.storeReaction(ctx, message)
+	case config.PinMessageAction:
+		err = room.roomRepo.AddPin(ctx, entity.Pin{
+			RoomID:    room.ID,
+			MessageID: message.ID,
+			PinnedBy:  message.SenderID,
+			PinnedAt:  message.CreatedAt,
+		})
+	case config.UnpinMessageAction:
+		err = room.roomRepo.RemovePin(ctx, room.ID, message.ID)
+	case config.TopicChangedAction:
+		err = room.roomRepo.UpdateTopic(ctx, room.ID, message.Content)
+	case config.MarkReadAction:
+		var moved bool
+		moved, err = room.readCursorRepo.Upsert(ctx, entity.ReadCursor{
+			RoomID:    room.ID,
+			UserID:    message.SenderID,
+			MessageID: message.ID,
+			UpdatedAt: message.CreatedAt,
+		})
+		// Positions behind the stored cursor are not news to anyone.
+		if err == nil && !moved {
+			return
+		}
+	}
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	room.publishRoomMessage(ctx, message.Encode())
+
+	if message.Action == config.SendMessageAction && message.Nonce != "" {
+		room.ackSender(message.SenderID, message.ID, message.Nonce)
+	}
+	if message.Action == config.SendMessageAction && len(message.Mentions) > 0 {
+		mention.Publish(ctx, room.roomRepo, room.pubsubRepo, message)
+	}
+	if message.Action == config.SendMessageAction && room.Direct {
+		room.publishDirectMessage(ctx, message)
+	}
+	if message.Action == config.SendMessageAction {
+		room.webhookDispatcher.Dispatch(ctx, room.ID, config.WebhookEventMessage, message)
+	}
+}
+
+// Store a new message once per client nonce. A retry of a nonce that was already
+// stored is acknowledged with the original message ID and reports false.
+func (room *Room) storeMessage(ctx context.Context, message *entity.Message) (bool, error) {
+	if message.Nonce != "" {
+		id, err := room.nonceRepo.Reserve(ctx, message.SenderID, message.Nonce, message.ID, config.NonceWindow)
+		if err != nil {
+			return false, err
+		}
+		if id != message.ID {
+			room.ackSender(message.SenderID, id, message.Nonce)
+			return false, nil
+		}
+	}
+
+	if err := room.messageRepo.Create(ctx, *message); err != nil {
+		// Let the client retry the same nonce.
+		if message.Nonce != "" {
+			if releaseErr := room.nonceRepo.Release(ctx, message.SenderID, message.Nonce); releaseErr != nil {
+				log.Print(releaseErr)
+			}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Tell the sender's connections in the room which message ID their nonce was stored under
+func (room *Room) ackSender(senderID string, messageID string, nonce string) {
+	message := &entity.Message{
+		ID:       messageID,
+		Action:   config.AckAction,
+		TargetID: room.ID,
+		SenderID: senderID,
+		Nonce:    nonce,
+	}
+
+	for client := range room.clients {
+		if client.ID == senderID {
+			client.send <- message.Encode()
+		}
+	}
+}
+
+// Persist the reaction change and attach the updated counts of the message to the event
+func (room *Room) storeReaction(ctx context.Context, message *entity.Message) error {
+	reaction := entity.Reaction{
+		MessageID: message.ID,
+		UserID:    message.SenderID,
+		Emoji:     message.Content,
+	}
+
+	var err error
+	if message.Action == config.AddReactionAction {
+		err = room.reactionRepo.Add(ctx, reaction)
+	} else {
+		err = room.reactionRepo.Remove(ctx, reaction)
+	}
+	if err != nil {
+		return err
+	}
+
+	message.Reactions, err = room.reactionRepo.Count(ctx, message.ID)
+	return err
+}
+
 // TODO: ここでは、チャンネルをroomの名前にしている。一意せいないので命名考える
 func (room *Room) publishRoomMessage(ctx context.Context, message []byte) {
 	err := room.pubsubRepo.Publish(ctx, room.Name, message)
@@ -113,6 +388,11 @@ func (room *Room) subscribeToRoomMessages(ctx context.Context) {
 	ch := pubsub.Channel()
 
 	for msg := range ch {
-		room.broadcastToClientsInRoom([]byte(msg.Payload))
+		payload := []byte(msg.Payload)
+		if senderID, ok := isTypingEvent(payload); ok {
+			room.broadcastToOtherClientsInRoom(payload, senderID)
+			continue
+		}
+		room.broadcastToClientsInRoom(payload)
 	}
 }
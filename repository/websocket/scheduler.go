@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/markdown"
+	"github.com/tusmasoma/simple-chat/internal/mention"
+)
+
+// Store the message to be sent at message.SendAt and reply to the client with the schedule.
+func (client *Client) handleScheduleMessage(message entity.Message) {
+	room := client.findRoom(message.TargetID)
+	if room == nil || !client.isInRoom(room) {
+		return
+	}
+
+	now := time.Now().UTC()
+	if message.SendAt == nil || !message.SendAt.After(now) || message.SendAt.After(now.Add(config.MaxScheduleAhead)) {
+		client.notifyError(message, config.ErrInvalidSchedule)
+		return
+	}
+	if strings.TrimSpace(message.Content) == "" {
+		client.notifyError(message, config.ErrEmptyMessage)
+		return
+	}
+	if !client.hub.resolveParent(&message, room) {
+		client.notifyError(message, config.ErrMessageNotFound)
+		return
+	}
+	// Uploads expire before most schedules are due, so they cannot be scheduled.
+	if len(message.Attachments) > 0 {
+		client.notifyError(message, config.ErrInvalidAttachment)
+		return
+	}
+
+	scheduled := entity.ScheduledMessage{
+		ID:        uuid.New().String(),
+		RoomID:    room.ID,
+		SenderID:  client.ID,
+		Content:   message.Content,
+		ParentID:  message.ParentID,
+		SendAt:    message.SendAt.UTC(),
+		CreatedAt: now,
+	}
+	if err := client.hub.scheduledMessageRepo.Create(context.Background(), scheduled); err != nil {
+		log.Println(err)
+		return
+	}
+
+	reply := &entity.Message{
+		ID:        scheduled.ID,
+		Action:    config.ScheduleMessageAction,
+		Content:   scheduled.Content,
+		TargetID:  scheduled.RoomID,
+		SenderID:  scheduled.SenderID,
+		ParentID:  scheduled.ParentID,
+		SendAt:    &scheduled.SendAt,
+		CreatedAt: scheduled.CreatedAt,
+	}
+	client.send <- reply.Encode()
+}
+
+// Send the scheduled messages that are due, every config.SchedulerInterval
+func (h *Hub) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(config.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.sendDueMessages(ctx)
+		}
+	}
+}
+
+func (h *Hub) sendDueMessages(ctx context.Context) {
+	due, err := h.scheduledMessageRepo.ListDue(ctx, time.Now().UTC(), config.SchedulerBatchSize)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, scheduled := range due {
+		h.sendScheduledMessage(ctx, scheduled)
+	}
+}
+
+// Send a scheduled message exactly once across all nodes. The lease keeps nodes from
+// sending it concurrently, and the message ID claimed in storage makes a retry after a
+// node failed midway a duplicate that the room drops when storing it. The schedule is
+// only deleted by a later pass, once the lease is over and the message is found stored.
+func (h *Hub) sendScheduledMessage(ctx context.Context, scheduled *entity.ScheduledMessage) {
+	locked, err := h.lockRepo.TryLock(ctx, "schedule:"+scheduled.ID, config.ScheduleLeaseTTL)
+	if err != nil {
+		log.Println(err)
+		return
+	} else if !locked {
+		return
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	messageID, err := h.scheduledMessageRepo.Claim(ctx, scheduled.ID, id.String())
+	if errors.Is(err, sql.ErrNoRows) {
+		// Cancelled after it was listed.
+		return
+	} else if err != nil {
+		log.Println(err)
+		return
+	}
+	// An earlier pass sent it; delete the schedule once the room stored the message.
+	if messageID != id.String() {
+		if _, err = h.messageRepo.Get(ctx, messageID); err == nil {
+			h.deleteScheduledMessage(ctx, scheduled.ID)
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+	}
+
+	var room *Room
+	h.call(func() {
+		room = h.findOrRunRoomByID(ctx, scheduled.RoomID)
+	})
+	if room == nil {
+		h.deleteScheduledMessage(ctx, scheduled.ID)
+		return
+	}
+	// The sender may have left the room since scheduling.
+	isMember, err := h.roomRepo.IsMember(ctx, room.ID, scheduled.SenderID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if !isMember {
+		h.deleteScheduledMessage(ctx, scheduled.ID)
+		return
+	}
+
+	message := &entity.Message{
+		ID:        messageID,
+		Action:    config.SendMessageAction,
+		Content:   scheduled.Content,
+		HTML:      markdown.Render(scheduled.Content),
+		TargetID:  room.ID,
+		SenderID:  scheduled.SenderID,
+		ParentID:  scheduled.ParentID,
+		Mentions:  mention.Resolve(ctx, h.userRepo, scheduled.Content, scheduled.SenderID),
+		CreatedAt: time.Now().UTC(),
+	}
+	room.broadcast <- message
+}
+
+func (h *Hub) deleteScheduledMessage(ctx context.Context, id string) {
+	if err := h.scheduledMessageRepo.Delete(ctx, id); err != nil {
+		log.Println(err)
+	}
+}
+
+// Find the room running on this node, or start it from storage. Call it on the hub goroutine.
+func (h *Hub) findOrRunRoomByID(ctx context.Context, id string) *Room {
+	if room := h.findRoomByID(id); room != nil {
+		return room
+	}
+	roomEntity, err := h.roomRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil
+	}
+	return h.runRoomFromRepository(roomEntity.Name)
+}
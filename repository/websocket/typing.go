@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+)
+
+// typingState tracks a user typing in a room served by this node.
+type typingState struct {
+	lastTypingAt time.Time
+	publishedAt  time.Time
+	timer        *time.Timer
+}
+
+// Typing events are ephemeral: they are throttled per user, never stored,
+// and a stop event is published when the user goes quiet for TypingTimeout.
+func (room *Room) handleTyping(ctx context.Context, message *entity.Message) {
+	userID := message.SenderID
+	if message.Action == config.StopTypingAction {
+		room.stopTyping(ctx, userID)
+		return
+	}
+
+	now := time.Now()
+	state, ok := room.typing[userID]
+	if !ok {
+		state = &typingState{
+			timer: time.AfterFunc(config.TypingTimeout, func() { room.typingExpired <- userID }),
+		}
+		room.typing[userID] = state
+	} else {
+		state.timer.Reset(config.TypingTimeout)
+	}
+	state.lastTypingAt = now
+
+	if now.Sub(state.publishedAt) < config.TypingThrottle {
+		return
+	}
+	state.publishedAt = now
+	room.publishRoomMessage(ctx, message.Encode())
+}
+
+func (room *Room) expireTyping(ctx context.Context, userID string) {
+	state, ok := room.typing[userID]
+	// The timer may have fired just before a new typing event reset it.
+	if !ok || time.Since(state.lastTypingAt) < config.TypingTimeout {
+		return
+	}
+	room.stopTyping(ctx, userID)
+}
+
+func (room *Room) stopTyping(ctx context.Context, userID string) {
+	state, ok := room.typing[userID]
+	if !ok {
+		return
+	}
+	state.timer.Stop()
+	delete(room.typing, userID)
+
+	message := &entity.Message{
+		Action:   config.StopTypingAction,
+		TargetID: room.ID,
+		SenderID: userID,
+	}
+	room.publishRoomMessage(ctx, message.Encode())
+}
+
+// Typing events are not delivered to the connections of the user who is typing.
+func isTypingEvent(payload []byte) (string, bool) {
+	var message struct {
+		Action   string `json:"action"`
+		SenderID string `json:"sender"`
+	}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		log.Println(err)
+		return "", false
+	}
+	if message.Action != config.TypingAction && message.Action != config.StopTypingAction {
+		return "", false
+	}
+	return message.SenderID, true
+}
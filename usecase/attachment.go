@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var (
+	ErrNotRoomMember      = errors.New("room: user is not a member")
+	ErrAttachmentTooLarge = errors.New("attachment: file too large")
+	ErrAttachmentNotFound = errors.New("attachment: not found")
+)
+
+const (
+	maxAttachmentNameLength = 255
+	mimeSniffLength         = 512
+)
+
+type AttachmentUseCase interface {
+	Upload(ctx context.Context, userID string, roomID string, name string, r io.Reader) (*entity.Attachment, error)
+	Open(ctx context.Context, userID string, attachmentID string) (*entity.Attachment, io.ReadCloser, error)
+	// OpenThumbnail returns the thumbnail of an image attachment and its MIME type.
+	OpenThumbnail(ctx context.Context, userID string, attachmentID string) (io.ReadCloser, string, error)
+}
+
+type attachmentUseCase struct {
+	ar repository.AttachmentRepository
+	rr repository.RoomRepository
+	mr repository.MessageRepository
+	bs repository.BlobStore
+}
+
+func NewAttachmentUseCase(ar repository.AttachmentRepository, rr repository.RoomRepository, mr repository.MessageRepository, bs repository.BlobStore) AttachmentUseCase {
+	return &attachmentUseCase{
+		ar: ar,
+		rr: rr,
+		mr: mr,
+		bs: bs,
+	}
+}
+
+// Upload stores a file for the room. The MIME type is detected from the content rather
+// than trusted from the client.
+func (auc *attachmentUseCase) Upload(ctx context.Context, userID string, roomID string, name string, r io.Reader) (*entity.Attachment, error) {
+	if err := auc.checkMember(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(r, mimeSniffLength)
+	head, err := br.Peek(mimeSniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Failed to read upload: %v", err)
+		return nil, err
+	}
+
+	attachment := entity.Attachment{
+		ID:         uuid.New().String(),
+		RoomID:     roomID,
+		UploaderID: userID,
+		Name:       sanitizeAttachmentName(name),
+		MIMEType:   http.DetectContentType(head),
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	// Read one byte past the limit to tell a file of exactly the max size from a larger one.
+	attachment.Size, err = auc.bs.Put(ctx, attachment.ID, io.LimitReader(br, config.MaxAttachmentSize+1))
+	if err != nil {
+		log.Printf("Failed to store attachment: %v", err)
+		return nil, err
+	}
+	if attachment.Size > config.MaxAttachmentSize {
+		auc.deleteBlob(ctx, attachment.ID)
+		return nil, ErrAttachmentTooLarge
+	}
+	if thumbnailable(attachment.MIMEType) {
+		auc.makeThumbnail(ctx, &attachment)
+	}
+
+	if err = auc.ar.Create(ctx, attachment); err != nil {
+		log.Printf("Failed to create attachment: %v", attachment.ID)
+		auc.deleteBlob(ctx, attachment.ID)
+		auc.deleteBlob(ctx, thumbnailKey(attachment.ID))
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// Record the dimensions of an image attachment and store a thumbnail of it. An image that
+// cannot be decoded is still a valid attachment, so failures only leave the fields unset.
+func (auc *attachmentUseCase) makeThumbnail(ctx context.Context, attachment *entity.Attachment) {
+	content, err := auc.bs.Open(ctx, attachment.ID)
+	if err != nil {
+		log.Printf("Failed to open attachment: %v", attachment.ID)
+		return
+	}
+	cfg, err := decodeImageConfig(content)
+	content.Close()
+	// The dimensions of an image too large to thumbnail are still known.
+	if errors.Is(err, errImageTooLarge) {
+		attachment.Width, attachment.Height = cfg.Width, cfg.Height
+		return
+	} else if err != nil {
+		log.Printf("Failed to read image of attachment %v: %v", attachment.ID, err)
+		return
+	}
+	attachment.Width, attachment.Height = cfg.Width, cfg.Height
+
+	content, err = auc.bs.Open(ctx, attachment.ID)
+	if err != nil {
+		log.Printf("Failed to open attachment: %v", attachment.ID)
+		return
+	}
+	thumb, err := encodeThumbnail(content)
+	content.Close()
+	if err != nil {
+		log.Printf("Failed to make thumbnail of attachment %v: %v", attachment.ID, err)
+		return
+	}
+	if _, err = auc.bs.Put(ctx, thumbnailKey(attachment.ID), bytes.NewReader(thumb)); err != nil {
+		log.Printf("Failed to store thumbnail of attachment: %v", attachment.ID)
+		return
+	}
+	attachment.ThumbnailURL = fmt.Sprintf(config.AttachmentThumbnailPath, attachment.ID)
+}
+
+// Open returns the attachment and its content if userID is a member of its room.
+func (auc *attachmentUseCase) Open(ctx context.Context, userID string, attachmentID string) (*entity.Attachment, io.ReadCloser, error) {
+	attachment, err := auc.getVisible(ctx, userID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := auc.bs.Open(ctx, attachment.ID)
+	if err != nil {
+		log.Printf("Failed to open attachment: %v", attachment.ID)
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+func (auc *attachmentUseCase) OpenThumbnail(ctx context.Context, userID string, attachmentID string) (io.ReadCloser, string, error) {
+	attachment, err := auc.getVisible(ctx, userID, attachmentID)
+	if err != nil {
+		return nil, "", err
+	}
+	if attachment.ThumbnailURL == "" {
+		return nil, "", ErrAttachmentNotFound
+	}
+
+	content, err := auc.bs.Open(ctx, thumbnailKey(attachment.ID))
+	if err != nil {
+		log.Printf("Failed to open thumbnail of attachment: %v", attachment.ID)
+		return nil, "", err
+	}
+	// Thumbnails are PNG or JPEG depending on the source, so sniff rather than store the type.
+	br := bufio.NewReaderSize(content, mimeSniffLength)
+	head, err := br.Peek(mimeSniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		content.Close()
+		log.Printf("Failed to read thumbnail of attachment: %v", attachment.ID)
+		return nil, "", err
+	}
+	return readCloser{br, content}, http.DetectContentType(head), nil
+}
+
+// getVisible returns the attachment if userID is a member of its room and its message,
+// if sent, has not been deleted.
+func (auc *attachmentUseCase) getVisible(ctx context.Context, userID string, attachmentID string) (*entity.Attachment, error) {
+	attachment, err := auc.ar.Get(ctx, attachmentID)
+	if err != nil {
+		return nil, ErrAttachmentNotFound
+	}
+	if err = auc.checkMember(ctx, attachment.RoomID, userID); err != nil {
+		return nil, err
+	}
+	// A redacted message takes its attachments with it.
+	if attachment.MessageID != "" {
+		message, err := auc.mr.Get(ctx, attachment.MessageID)
+		if err != nil || message.DeletedAt != nil {
+			return nil, ErrAttachmentNotFound
+		}
+	}
+	return attachment, nil
+}
+
+func (auc *attachmentUseCase) checkMember(ctx context.Context, roomID string, userID string) error {
+	isMember, err := auc.rr.IsMember(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check member of room: %v", roomID)
+		return err
+	}
+	if !isMember {
+		return ErrNotRoomMember
+	}
+	return nil
+}
+
+func (auc *attachmentUseCase) deleteBlob(ctx context.Context, key string) {
+	if err := auc.bs.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete blob: %v", key)
+	}
+}
+
+// readCloser reads from a buffered reader and closes the underlying file.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func sanitizeAttachmentName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return "file"
+	}
+	if len(name) > maxAttachmentNameLength {
+		name = name[len(name)-maxAttachmentNameLength:]
+	}
+	return name
+}
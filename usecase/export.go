@@ -0,0 +1,119 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var ErrInvalidExportRange = errors.New("export: invalid time range")
+
+const exportPageSize = 100
+
+// TranscriptWriter encodes a room export. WriteHeader is called once the caller is known
+// to be allowed to export the room, before any message.
+type TranscriptWriter interface {
+	WriteHeader(room *entity.Room, from time.Time, to time.Time) error
+	WriteMessage(message *entity.ExportedMessage) error
+	WriteFooter() error
+}
+
+type ExportUseCase interface {
+	ExportRoom(ctx context.Context, userID string, roomID string, from time.Time, to time.Time, tw TranscriptWriter) error
+}
+
+type exportUseCase struct {
+	mr  repository.MessageRepository
+	rr  repository.RoomRepository
+	ur  repository.UserRepository
+	rer repository.ReactionRepository
+	ar  repository.AttachmentRepository
+}
+
+func NewExportUseCase(mr repository.MessageRepository, rr repository.RoomRepository, ur repository.UserRepository, rer repository.ReactionRepository, ar repository.AttachmentRepository) ExportUseCase {
+	return &exportUseCase{
+		mr:  mr,
+		rr:  rr,
+		ur:  ur,
+		rer: rer,
+		ar:  ar,
+	}
+}
+
+// ExportRoom writes the messages of the room created in [from, to), oldest first, a page
+// at a time so that the history is never held in memory. A zero from starts at the
+// beginning of the room and a zero to ends now.
+func (euc *exportUseCase) ExportRoom(ctx context.Context, userID string, roomID string, from time.Time, to time.Time, tw TranscriptWriter) error {
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if !from.Before(to) {
+		return ErrInvalidExportRange
+	}
+
+	isMember, err := euc.rr.IsMember(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check member of room: %v", roomID)
+		return err
+	}
+	if !isMember {
+		return ErrNotRoomMember
+	}
+	room, err := euc.rr.GetByID(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to get room: %v", roomID)
+		return err
+	}
+
+	if err = tw.WriteHeader(room, from, to); err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	afterID := ""
+	for {
+		messages, err := euc.mr.ListRange(ctx, roomID, afterID, from, to, exportPageSize)
+		if err != nil {
+			log.Printf("Failed to list messages of room: %v", roomID)
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		if err = loadMessageDetails(ctx, euc.rer, euc.ar, messages); err != nil {
+			return err
+		}
+		for _, message := range messages {
+			exported := &entity.ExportedMessage{
+				Message:    message,
+				SenderName: euc.senderName(ctx, names, message.SenderID),
+			}
+			if err = tw.WriteMessage(exported); err != nil {
+				return err
+			}
+		}
+		if len(messages) < exportPageSize {
+			break
+		}
+		afterID = messages[len(messages)-1].ID
+	}
+
+	return tw.WriteFooter()
+}
+
+// Senders that are not users, such as incoming webhooks, or that no longer exist keep their ID.
+func (euc *exportUseCase) senderName(ctx context.Context, names map[string]string, senderID string) string {
+	if name, ok := names[senderID]; ok {
+		return name
+	}
+	name := senderID
+	if user, err := euc.ur.Get(ctx, senderID); err == nil {
+		name = user.Name
+	}
+	names[senderID] = name
+	return name
+}
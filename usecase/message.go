@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"log"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/markdown"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+const (
+	defaultMessageListLimit = 50
+	maxMessageListLimit     = 100
+)
+
+type MessageUseCase interface {
+	ListRoomMessages(ctx context.Context, userID string, roomID string, before string, limit int) ([]*entity.Message, string, error)
+	ListMessageEdits(ctx context.Context, userID string, messageID string) ([]*entity.MessageEdit, error)
+	GetThread(ctx context.Context, userID string, parentID string, afterID string, limit int) (*entity.Message, []*entity.Message, error)
+	GetReadState(ctx context.Context, roomID string, userID string) ([]*entity.ReadCursor, int, error)
+}
+
+type messageUseCase struct {
+	mr  repository.MessageRepository
+	rer repository.ReactionRepository
+	rcr repository.ReadCursorRepository
+	ar  repository.AttachmentRepository
+	rr  repository.RoomRepository
+}
+
+func NewMessageUseCase(mr repository.MessageRepository, rer repository.ReactionRepository, rcr repository.ReadCursorRepository, ar repository.AttachmentRepository, rr repository.RoomRepository) MessageUseCase {
+	return &messageUseCase{
+		mr:  mr,
+		rer: rer,
+		rcr: rcr,
+		ar:  ar,
+		rr:  rr,
+	}
+}
+
+func (muc *messageUseCase) ListRoomMessages(ctx context.Context, userID string, roomID string, before string, limit int) ([]*entity.Message, string, error) {
+	if err := muc.checkMember(ctx, roomID, userID); err != nil {
+		return nil, "", err
+	}
+	messages, next, err := muc.mr.List(ctx, roomID, before, clampLimit(limit))
+	if err != nil {
+		log.Printf("Failed to list messages of room: %v", roomID)
+		return nil, "", err
+	}
+	if err = loadMessageDetails(ctx, muc.rer, muc.ar, messages); err != nil {
+		return nil, "", err
+	}
+	return messages, next, nil
+}
+
+// GetThread returns the root message of a thread with its reply count and a page of its replies.
+func (muc *messageUseCase) GetThread(ctx context.Context, userID string, parentID string, afterID string, limit int) (*entity.Message, []*entity.Message, error) {
+	parent, err := muc.mr.Get(ctx, parentID)
+	if err != nil {
+		log.Printf("Failed to get message: %v", parentID)
+		return nil, nil, err
+	}
+	if err = muc.checkMember(ctx, parent.TargetID, userID); err != nil {
+		return nil, nil, err
+	}
+	replies, err := muc.mr.ListReplies(ctx, parentID, afterID, clampLimit(limit))
+	if err != nil {
+		log.Printf("Failed to list replies of message: %v", parentID)
+		return nil, nil, err
+	}
+	if err = loadMessageDetails(ctx, muc.rer, muc.ar, append([]*entity.Message{parent}, replies...)); err != nil {
+		return nil, nil, err
+	}
+	return parent, replies, nil
+}
+
+func (muc *messageUseCase) ListMessageEdits(ctx context.Context, userID string, messageID string) ([]*entity.MessageEdit, error) {
+	message, err := muc.mr.Get(ctx, messageID)
+	if err != nil {
+		log.Printf("Failed to get message: %v", messageID)
+		return nil, err
+	}
+	if err = muc.checkMember(ctx, message.TargetID, userID); err != nil {
+		return nil, err
+	}
+	edits, err := muc.mr.ListEdits(ctx, messageID)
+	if err != nil {
+		log.Printf("Failed to list edits of message: %v", messageID)
+		return nil, err
+	}
+	return edits, nil
+}
+
+// GetReadState returns the read cursors of every user in the room and the unread count of userID.
+func (muc *messageUseCase) GetReadState(ctx context.Context, roomID string, userID string) ([]*entity.ReadCursor, int, error) {
+	if err := muc.checkMember(ctx, roomID, userID); err != nil {
+		return nil, 0, err
+	}
+	cursors, err := muc.rcr.ListByRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to list read cursors of room: %v", roomID)
+		return nil, 0, err
+	}
+
+	// A user without a cursor has read nothing yet.
+	var lastReadID string
+	for _, cursor := range cursors {
+		if cursor.UserID == userID {
+			lastReadID = cursor.MessageID
+			break
+		}
+	}
+	unread, err := muc.mr.CountUnread(ctx, roomID, lastReadID, userID)
+	if err != nil {
+		log.Printf("Failed to count unread messages of room: %v", roomID)
+		return nil, 0, err
+	}
+	return cursors, unread, nil
+}
+
+func (muc *messageUseCase) checkMember(ctx context.Context, roomID string, userID string) error {
+	isMember, err := muc.rr.IsMember(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check member of room: %v", roomID)
+		return err
+	}
+	if !isMember {
+		return ErrNotRoomMember
+	}
+	return nil
+}
+
+// loadMessageDetails fills in the reactions and attachments of stored messages.
+func loadMessageDetails(ctx context.Context, rr repository.ReactionRepository, ar repository.AttachmentRepository, messages []*entity.Message) error {
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	counts, err := rr.CountByMessageIDs(ctx, ids)
+	if err != nil {
+		log.Printf("Failed to count reactions")
+		return err
+	}
+	attachments, err := ar.ListByMessageIDs(ctx, ids)
+	if err != nil {
+		log.Printf("Failed to list attachments")
+		return err
+	}
+	renderMessages(messages)
+	for _, message := range messages {
+		message.Reactions = counts[message.ID]
+		// A redacted message takes its attachments with it.
+		if message.DeletedAt == nil {
+			message.Attachments = attachments[message.ID]
+		}
+	}
+	return nil
+}
+
+// renderMessages fills in the HTML rendering of the content of stored messages.
+func renderMessages(messages []*entity.Message) {
+	for _, message := range messages {
+		message.HTML = markdown.Render(message.Content)
+	}
+}
+
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return defaultMessageListLimit
+	} else if limit > maxMessageListLimit {
+		return maxMessageListLimit
+	}
+	return limit
+}
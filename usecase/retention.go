@@ -0,0 +1,119 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+type RetentionUseCase interface {
+	PurgeExpiredMessages(ctx context.Context) error
+	// RunPurger purges expired messages every interval until ctx is done.
+	RunPurger(ctx context.Context, interval time.Duration)
+}
+
+type retentionUseCase struct {
+	rr repository.RoomRepository
+	mr repository.MessageRepository
+	ar repository.AttachmentRepository
+	bs repository.BlobStore
+}
+
+func NewRetentionUseCase(rr repository.RoomRepository, mr repository.MessageRepository, ar repository.AttachmentRepository, bs repository.BlobStore) RetentionUseCase {
+	return &retentionUseCase{
+		rr: rr,
+		mr: mr,
+		ar: ar,
+		bs: bs,
+	}
+}
+
+func (ruc *retentionUseCase) PurgeExpiredMessages(ctx context.Context) error {
+	start := time.Now()
+	rooms, err := ruc.rr.ListWithRetention(ctx)
+	if err != nil {
+		log.Printf("Failed to list rooms with retention policies")
+		return err
+	}
+
+	var total int64
+	var purgedRooms int
+	for _, room := range rooms {
+		var deleted int64
+		if room.RetentionDays > 0 {
+			n, err := ruc.mr.DeleteBefore(ctx, room.ID, start.AddDate(0, 0, -room.RetentionDays))
+			if err != nil {
+				log.Printf("Failed to purge messages of room: %v", room.ID)
+				continue
+			}
+			deleted += n
+		}
+		if room.RetentionMessages > 0 {
+			n, err := ruc.mr.DeleteExceptLatest(ctx, room.ID, room.RetentionMessages)
+			if err != nil {
+				log.Printf("Failed to purge messages of room: %v", room.ID)
+				continue
+			}
+			deleted += n
+		}
+		if deleted > 0 {
+			total += deleted
+			purgedRooms++
+		}
+	}
+
+	files := ruc.purgeAttachments(ctx, start)
+
+	log.Printf(
+		"Retention purge: deleted %d messages from %d of %d rooms and %d attachments in %s",
+		total, purgedRooms, len(rooms), files, time.Since(start),
+	)
+	return nil
+}
+
+// purgeAttachments deletes the attachments of deleted or redacted messages and the
+// uploads that were never sent, and returns how many were deleted.
+func (ruc *retentionUseCase) purgeAttachments(ctx context.Context, now time.Time) int {
+	attachments, err := ruc.ar.ListGarbage(ctx, now.Add(-config.UnsentAttachmentTTL))
+	if err != nil {
+		log.Printf("Failed to list attachments to purge")
+		return 0
+	}
+
+	var deleted int
+	for _, attachment := range attachments {
+		if err = ruc.bs.Delete(ctx, attachment.ID); err != nil {
+			log.Printf("Failed to delete blob: %v", attachment.ID)
+			continue
+		}
+		if err = ruc.bs.Delete(ctx, thumbnailKey(attachment.ID)); err != nil {
+			log.Printf("Failed to delete thumbnail: %v", attachment.ID)
+			continue
+		}
+		if err = ruc.ar.Delete(ctx, attachment.ID); err != nil {
+			log.Printf("Failed to delete attachment: %v", attachment.ID)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+func (ruc *retentionUseCase) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ruc.PurgeExpiredMessages(ctx); err != nil {
+			log.Printf("Retention purge failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var (
+	ErrNotRoomModerator = errors.New("room: user is not a moderator")
+	ErrInvalidRetention = errors.New("room: invalid retention policy")
+)
+
+type RoomUseCase interface {
+	ListPins(ctx context.Context, userID string, roomID string) ([]*entity.Pin, error)
+	UpdateRetention(ctx context.Context, userID string, roomID string, days int, messages int) error
+	ListDirectConversations(ctx context.Context, userID string) ([]*entity.DirectConversation, error)
+}
+
+type roomUseCase struct {
+	rr repository.RoomRepository
+	mr repository.MessageRepository
+	ur repository.UserRepository
+}
+
+func NewRoomUseCase(rr repository.RoomRepository, mr repository.MessageRepository, ur repository.UserRepository) RoomUseCase {
+	return &roomUseCase{
+		rr: rr,
+		mr: mr,
+		ur: ur,
+	}
+}
+
+// ListPins returns the pins of the room, most recent first, with the pinned messages.
+func (ruc *roomUseCase) ListPins(ctx context.Context, userID string, roomID string) ([]*entity.Pin, error) {
+	isMember, err := ruc.rr.IsMember(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check member of room: %v", roomID)
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
+	}
+
+	pins, err := ruc.rr.ListPins(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to list pins of room: %v", roomID)
+		return nil, err
+	}
+	listed := make([]*entity.Pin, 0, len(pins))
+	for _, pin := range pins {
+		pin.Message, err = ruc.mr.Get(ctx, pin.MessageID)
+		// The message may have been purged by retention since it was pinned.
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} else if err != nil {
+			log.Printf("Failed to get pinned message: %v", pin.MessageID)
+			return nil, err
+		}
+		if pin.Message.DeletedAt != nil {
+			continue
+		}
+		renderMessages([]*entity.Message{pin.Message})
+		listed = append(listed, pin)
+	}
+	return listed, nil
+}
+
+// UpdateRetention sets how long the room keeps its messages. Only moderators may change it.
+func (ruc *roomUseCase) UpdateRetention(ctx context.Context, userID string, roomID string, days int, messages int) error {
+	if days < 0 || messages < 0 {
+		return ErrInvalidRetention
+	}
+
+	isModerator, err := ruc.rr.IsModerator(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check moderator of room: %v", roomID)
+		return err
+	}
+	if !isModerator {
+		return ErrNotRoomModerator
+	}
+
+	if err = ruc.rr.UpdateRetention(ctx, roomID, days, messages); err != nil {
+		log.Printf("Failed to update retention of room: %v", roomID)
+		return err
+	}
+	return nil
+}
+
+// ListDirectConversations returns the direct message rooms of the user with the other user
+// of each, most recently active first.
+func (ruc *roomUseCase) ListDirectConversations(ctx context.Context, userID string) ([]*entity.DirectConversation, error) {
+	rooms, err := ruc.rr.ListByMember(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to list rooms of user: %v", userID)
+		return nil, err
+	}
+
+	var conversations []*entity.DirectConversation
+	for _, room := range rooms {
+		if !room.Direct {
+			continue
+		}
+		conversation := &entity.DirectConversation{
+			RoomID: room.ID,
+			PeerID: entity.DirectRoomPeer(room.Name, userID),
+		}
+		// A user who is gone keeps the conversation, without a name.
+		if peer, err := ruc.ur.Get(ctx, conversation.PeerID); err == nil {
+			conversation.PeerName = peer.Name
+		} else {
+			log.Printf("Failed to get user: %v", conversation.PeerID)
+		}
+
+		messages, _, err := ruc.mr.List(ctx, room.ID, "", 1)
+		if err != nil {
+			log.Printf("Failed to list messages of room: %v", room.ID)
+			return nil, err
+		}
+		if len(messages) > 0 {
+			renderMessages(messages)
+			conversation.LastMessage = messages[0]
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	// Message IDs sort by time; conversations without messages go last.
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return lastMessageID(conversations[i]) > lastMessageID(conversations[j])
+	})
+	return conversations, nil
+}
+
+func lastMessageID(conversation *entity.DirectConversation) string {
+	if conversation.LastMessage == nil {
+		return ""
+	}
+	return conversation.LastMessage.ID
+}
@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var (
+	ErrInvalidSchedule        = errors.New("schedule: send time must be in the future")
+	ErrInvalidScheduleContent = errors.New("schedule: invalid message")
+	ErrScheduleNotFound       = errors.New("schedule: not found")
+	ErrParentNotFound         = errors.New("schedule: parent message not found")
+)
+
+type ScheduleUseCase interface {
+	ScheduleMessage(ctx context.Context, userID string, roomID string, content string, parentID string, sendAt time.Time) (*entity.ScheduledMessage, error)
+	ListScheduledMessages(ctx context.Context, userID string) ([]*entity.ScheduledMessage, error)
+	// CancelScheduledMessage fails with ErrScheduleNotFound once the message is being sent.
+	CancelScheduledMessage(ctx context.Context, userID string, id string) error
+}
+
+type scheduleUseCase struct {
+	smr repository.ScheduledMessageRepository
+	rr  repository.RoomRepository
+	mr  repository.MessageRepository
+}
+
+func NewScheduleUseCase(smr repository.ScheduledMessageRepository, rr repository.RoomRepository, mr repository.MessageRepository) ScheduleUseCase {
+	return &scheduleUseCase{
+		smr: smr,
+		rr:  rr,
+		mr:  mr,
+	}
+}
+
+func (suc *scheduleUseCase) ScheduleMessage(ctx context.Context, userID string, roomID string, content string, parentID string, sendAt time.Time) (*entity.ScheduledMessage, error) {
+	now := time.Now().UTC()
+	if !sendAt.After(now) || sendAt.After(now.Add(config.MaxScheduleAhead)) {
+		return nil, ErrInvalidSchedule
+	}
+	if strings.TrimSpace(content) == "" || len(content) > config.MaxMessageSize {
+		return nil, ErrInvalidScheduleContent
+	}
+
+	isMember, err := suc.rr.IsMember(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check member of room: %v", roomID)
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotRoomMember
+	}
+
+	if parentID != "" {
+		parent, err := suc.mr.Get(ctx, parentID)
+		if err != nil || parent.TargetID != roomID || parent.DeletedAt != nil {
+			return nil, ErrParentNotFound
+		}
+		// Threads are one level deep: a reply to a reply joins the root thread.
+		if parent.ParentID != "" {
+			parentID = parent.ParentID
+		}
+	}
+
+	scheduled := entity.ScheduledMessage{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		SenderID:  userID,
+		Content:   content,
+		ParentID:  parentID,
+		SendAt:    sendAt.UTC(),
+		CreatedAt: now,
+	}
+	if err = suc.smr.Create(ctx, scheduled); err != nil {
+		log.Printf("Failed to schedule message in room: %v", roomID)
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+func (suc *scheduleUseCase) ListScheduledMessages(ctx context.Context, userID string) ([]*entity.ScheduledMessage, error) {
+	list, err := suc.smr.ListBySender(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to list scheduled messages of user: %v", userID)
+		return nil, err
+	}
+	return list, nil
+}
+
+func (suc *scheduleUseCase) CancelScheduledMessage(ctx context.Context, userID string, id string) error {
+	cancelled, err := suc.smr.Cancel(ctx, id, userID)
+	if err != nil {
+		log.Printf("Failed to cancel scheduled message: %v", id)
+		return err
+	}
+	if !cancelled {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
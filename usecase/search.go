@@ -0,0 +1,166 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var ErrInvalidSearchQuery = errors.New("search: invalid query")
+
+const searchDateLayout = "2006-01-02"
+
+type SearchUseCase interface {
+	SearchMessages(ctx context.Context, userID string, query string, limit int) ([]*entity.Message, error)
+}
+
+type searchUseCase struct {
+	mr repository.MessageRepository
+	rr repository.RoomRepository
+	ur repository.UserRepository
+}
+
+func NewSearchUseCase(mr repository.MessageRepository, rr repository.RoomRepository, ur repository.UserRepository) SearchUseCase {
+	return &searchUseCase{
+		mr: mr,
+		rr: rr,
+		ur: ur,
+	}
+}
+
+// SearchMessages runs a query over the rooms userID is a member of. Besides words and
+// "quoted phrases" the query accepts the filters from:<user>, in:<room>,
+// before:<YYYY-MM-DD>, after:<YYYY-MM-DD> and on:<YYYY-MM-DD>.
+func (suc *searchUseCase) SearchMessages(ctx context.Context, userID string, query string, limit int) ([]*entity.Message, error) {
+	parsed, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms, err := suc.rr.ListByMember(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to list rooms of user: %v", userID)
+		return nil, err
+	}
+
+	search := entity.MessageSearch{
+		Match:  parsed.match,
+		After:  parsed.after,
+		Before: parsed.before,
+	}
+	for _, room := range rooms {
+		if parsed.roomName == "" || room.Name == parsed.roomName {
+			search.RoomIDs = append(search.RoomIDs, room.ID)
+		}
+	}
+
+	if parsed.userName != "" {
+		user, err := suc.ur.GetByName(ctx, parsed.userName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		} else if err != nil {
+			log.Printf("Failed to get user by name: %v", parsed.userName)
+			return nil, err
+		}
+		search.SenderID = user.ID
+	}
+
+	messages, err := suc.mr.Search(ctx, search, clampLimit(limit))
+	if err != nil {
+		log.Printf("Failed to search messages: %v", query)
+		return nil, err
+	}
+	renderMessages(messages)
+	return messages, nil
+}
+
+type searchQuery struct {
+	match    string
+	userName string
+	roomName string
+	after    time.Time
+	before   time.Time
+}
+
+func parseSearchQuery(query string) (searchQuery, error) {
+	var parsed searchQuery
+	var terms []string
+	for _, token := range tokenizeSearchQuery(query) {
+		if token.phrase {
+			terms = append(terms, quoteSearchTerm(token.text))
+			continue
+		}
+
+		key, value, ok := strings.Cut(token.text, ":")
+		if !ok || value == "" {
+			terms = append(terms, quoteSearchTerm(token.text))
+			continue
+		}
+		switch key {
+		case "from":
+			parsed.userName = strings.TrimPrefix(value, "@")
+		case "in":
+			parsed.roomName = strings.TrimPrefix(value, "#")
+		case "before", "after", "on":
+			date, err := time.Parse(searchDateLayout, value)
+			if err != nil {
+				return searchQuery{}, ErrInvalidSearchQuery
+			}
+			switch key {
+			case "before":
+				parsed.before = date
+			case "after":
+				parsed.after = date.AddDate(0, 0, 1)
+			case "on":
+				parsed.after = date
+				parsed.before = date.AddDate(0, 0, 1)
+			}
+		default:
+			terms = append(terms, quoteSearchTerm(token.text))
+		}
+	}
+
+	if len(terms) == 0 && parsed.userName == "" && parsed.roomName == "" && parsed.after.IsZero() && parsed.before.IsZero() {
+		return searchQuery{}, ErrInvalidSearchQuery
+	}
+	parsed.match = strings.Join(terms, " ")
+	return parsed, nil
+}
+
+type searchToken struct {
+	text   string
+	phrase bool
+}
+
+// tokenizeSearchQuery splits on whitespace, keeping "quoted phrases" together.
+func tokenizeSearchQuery(query string) []searchToken {
+	var tokens []searchToken
+	for {
+		query = strings.TrimSpace(query)
+		if query == "" {
+			return tokens
+		}
+		if query[0] == '"' {
+			phrase, rest, _ := strings.Cut(query[1:], `"`)
+			if phrase = strings.TrimSpace(phrase); phrase != "" {
+				tokens = append(tokens, searchToken{text: phrase, phrase: true})
+			}
+			query = rest
+			continue
+		}
+		text, rest, _ := strings.Cut(query, " ")
+		tokens = append(tokens, searchToken{text: text})
+		query = rest
+	}
+}
+
+// Quoting every term keeps user input from being read as FTS5 query syntax.
+func quoteSearchTerm(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
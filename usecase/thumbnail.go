@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif" // register the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/tusmasoma/simple-chat/config"
+)
+
+var errImageTooLarge = errors.New("thumbnail: image too large")
+
+const thumbnailJPEGQuality = 80
+
+// thumbnailable reports whether a thumbnail can be made from content of the MIME type.
+func thumbnailable(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// thumbnailKey is the blob key of the thumbnail of an attachment.
+func thumbnailKey(attachmentID string) string {
+	return attachmentID + ".thumb"
+}
+
+// decodeImageConfig reads the dimensions of an image without decoding its pixels.
+func decodeImageConfig(r io.Reader) (image.Config, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if cfg.Width*cfg.Height > config.MaxThumbnailSourcePixels {
+		return cfg, errImageTooLarge
+	}
+	return cfg, nil
+}
+
+// encodeThumbnail decodes the image, scales it down to fit within config.ThumbnailSize and
+// encodes it as JPEG for JPEG sources and as PNG otherwise, to keep transparency.
+// For an animated GIF only the first frame is used.
+func encodeThumbnail(r io.Reader) ([]byte, error) {
+	src, format, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	thumb := scaleDown(src, config.ThumbnailSize)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailJPEGQuality})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown resizes src to fit within a size x size square, keeping its aspect ratio.
+// Each destination pixel is the average of the source pixels it covers.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := sw, sh
+	if sw > size || sh > size {
+		if sw >= sh {
+			dw, dh = size, max(1, sh*size/sw)
+		} else {
+			dw, dh = max(1, sw*size/sh), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := bounds.Min.Y+dy*sh/dh, bounds.Min.Y+(dy+1)*sh/dh
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := bounds.Min.X+dx*sw/dw, bounds.Min.X+(dx+1)*sw/dw
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := src.At(x, y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
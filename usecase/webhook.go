@@ -0,0 +1,285 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tusmasoma/simple-chat/config"
+	"github.com/tusmasoma/simple-chat/entity"
+	"github.com/tusmasoma/simple-chat/internal/markdown"
+	"github.com/tusmasoma/simple-chat/internal/mention"
+	"github.com/tusmasoma/simple-chat/repository"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook: not found")
+	ErrInvalidWebhook     = errors.New("webhook: invalid name")
+	ErrInvalidWebhookPost = errors.New("webhook: invalid message")
+	ErrInvalidWebhookURL  = errors.New("webhook: invalid URL or events")
+)
+
+var webhookEvents = []string{config.WebhookEventMessage, config.WebhookEventJoin, config.WebhookEventLeave}
+
+const webhookTokenByteLength = 32
+
+type WebhookUseCase interface {
+	// CreateIncomingWebhook returns the webhook with its token, which is not stored.
+	CreateIncomingWebhook(ctx context.Context, userID string, roomID string, name string) (*entity.IncomingWebhook, string, error)
+	ListIncomingWebhooks(ctx context.Context, userID string, roomID string) ([]*entity.IncomingWebhook, error)
+	DeleteIncomingWebhook(ctx context.Context, userID string, roomID string, id string) error
+	// PostIncomingMessage stores the text as a message of the webhook's room and publishes it.
+	PostIncomingMessage(ctx context.Context, token string, text string) (*entity.Message, error)
+	// CreateOutgoingWebhook returns the webhook with the secret its deliveries are signed with.
+	// Without events, the webhook receives all of them.
+	CreateOutgoingWebhook(ctx context.Context, userID string, roomID string, rawURL string, events []string) (*entity.OutgoingWebhook, string, error)
+	ListOutgoingWebhooks(ctx context.Context, userID string, roomID string) ([]*entity.OutgoingWebhook, error)
+	DeleteOutgoingWebhook(ctx context.Context, userID string, roomID string, id string) error
+	ListWebhookDeliveries(ctx context.Context, userID string, roomID string, id string) ([]*entity.WebhookDelivery, error)
+}
+
+type webhookUseCase struct {
+	iwr repository.IncomingWebhookRepository
+	owr repository.OutgoingWebhookRepository
+	rr  repository.RoomRepository
+	mr  repository.MessageRepository
+	ur  repository.UserRepository
+	psr repository.PubSubRepository
+	wd  repository.WebhookDispatcher
+}
+
+func NewWebhookUseCase(iwr repository.IncomingWebhookRepository, owr repository.OutgoingWebhookRepository, rr repository.RoomRepository, mr repository.MessageRepository, ur repository.UserRepository, psr repository.PubSubRepository, wd repository.WebhookDispatcher) WebhookUseCase {
+	return &webhookUseCase{
+		iwr: iwr,
+		owr: owr,
+		rr:  rr,
+		mr:  mr,
+		ur:  ur,
+		psr: psr,
+		wd:  wd,
+	}
+}
+
+// CreateIncomingWebhook adds a webhook to the room. Only moderators may manage webhooks.
+func (wuc *webhookUseCase) CreateIncomingWebhook(ctx context.Context, userID string, roomID string, name string) (*entity.IncomingWebhook, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > config.MaxWebhookNameSize {
+		return nil, "", ErrInvalidWebhook
+	}
+	if err := wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return nil, "", err
+	}
+
+	token, err := newWebhookSecret()
+	if err != nil {
+		log.Printf("Failed to generate webhook token: %v", err)
+		return nil, "", err
+	}
+
+	webhook := entity.IncomingWebhook{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Name:      name,
+		TokenHash: hashWebhookToken(token),
+		CreatedBy: userID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = wuc.iwr.Create(ctx, webhook); err != nil {
+		log.Printf("Failed to create webhook in room: %v", roomID)
+		return nil, "", err
+	}
+	return &webhook, token, nil
+}
+
+func (wuc *webhookUseCase) ListIncomingWebhooks(ctx context.Context, userID string, roomID string) ([]*entity.IncomingWebhook, error) {
+	if err := wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+	webhooks, err := wuc.iwr.ListByRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to list webhooks of room: %v", roomID)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (wuc *webhookUseCase) DeleteIncomingWebhook(ctx context.Context, userID string, roomID string, id string) error {
+	if err := wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return err
+	}
+	deleted, err := wuc.iwr.Delete(ctx, roomID, id)
+	if err != nil {
+		log.Printf("Failed to delete webhook: %v", id)
+		return err
+	}
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// PostIncomingMessage is sent by the webhook itself: its ID is the sender of the message.
+// Like messages sent over a WebSocket, it is stored before it is published on the room's
+// channel, from which every node delivers it to its clients in the room, and then the
+// mentioned users and the room's outgoing webhooks are notified.
+func (wuc *webhookUseCase) PostIncomingMessage(ctx context.Context, token string, text string) (*entity.Message, error) {
+	webhook, err := wuc.iwr.GetByTokenHash(ctx, hashWebhookToken(token))
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	if strings.TrimSpace(text) == "" || len(text) > config.MaxMessageSize {
+		return nil, ErrInvalidWebhookPost
+	}
+	room, err := wuc.rr.GetByID(ctx, webhook.RoomID)
+	if err != nil {
+		log.Printf("Failed to get room of webhook: %v", webhook.ID)
+		return nil, err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		log.Printf("Failed to generate message ID: %v", err)
+		return nil, err
+	}
+	message := entity.Message{
+		ID:        id.String(),
+		Action:    config.SendMessageAction,
+		Content:   text,
+		HTML:      markdown.Render(text),
+		TargetID:  room.ID,
+		SenderID:  webhook.ID,
+		Mentions:  mention.Resolve(ctx, wuc.ur, text, webhook.ID),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = wuc.mr.Create(ctx, message); err != nil {
+		log.Printf("Failed to store message of webhook: %v", webhook.ID)
+		return nil, err
+	}
+	// Channels are named after rooms, as in Room.publishRoomMessage.
+	if err = wuc.psr.Publish(ctx, room.Name, message.Encode()); err != nil {
+		log.Printf("Failed to publish message of webhook: %v", webhook.ID)
+		return nil, err
+	}
+	if len(message.Mentions) > 0 {
+		mention.Publish(ctx, wuc.rr, wuc.psr, &message)
+	}
+	// Deliveries are retried after the request has been answered.
+	wuc.wd.Dispatch(context.WithoutCancel(ctx), room.ID, config.WebhookEventMessage, &message)
+	return &message, nil
+}
+
+// CreateOutgoingWebhook registers a URL to receive the room's events. Only moderators may manage webhooks.
+func (wuc *webhookUseCase) CreateOutgoingWebhook(ctx context.Context, userID string, roomID string, rawURL string, events []string) (*entity.OutgoingWebhook, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", ErrInvalidWebhookURL
+	}
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+	events = slices.Clone(events)
+	slices.Sort(events)
+	events = slices.Compact(events)
+	for _, event := range events {
+		if !slices.Contains(webhookEvents, event) {
+			return nil, "", ErrInvalidWebhookURL
+		}
+	}
+	if err = wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		return nil, "", err
+	}
+	webhook := entity.OutgoingWebhook{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		URL:       u.String(),
+		Events:    events,
+		Secret:    secret,
+		CreatedBy: userID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err = wuc.owr.Create(ctx, webhook); err != nil {
+		log.Printf("Failed to create outgoing webhook in room: %v", roomID)
+		return nil, "", err
+	}
+	return &webhook, secret, nil
+}
+
+func (wuc *webhookUseCase) ListOutgoingWebhooks(ctx context.Context, userID string, roomID string) ([]*entity.OutgoingWebhook, error) {
+	if err := wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+	webhooks, err := wuc.owr.ListByRoom(ctx, roomID)
+	if err != nil {
+		log.Printf("Failed to list outgoing webhooks of room: %v", roomID)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (wuc *webhookUseCase) DeleteOutgoingWebhook(ctx context.Context, userID string, roomID string, id string) error {
+	if err := wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return err
+	}
+	deleted, err := wuc.owr.Delete(ctx, roomID, id)
+	if err != nil {
+		log.Printf("Failed to delete outgoing webhook: %v", id)
+		return err
+	}
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest delivery attempts of the webhook, newest first.
+func (wuc *webhookUseCase) ListWebhookDeliveries(ctx context.Context, userID string, roomID string, id string) ([]*entity.WebhookDelivery, error) {
+	if err := wuc.checkModerator(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+	deliveries, err := wuc.owr.ListDeliveries(ctx, roomID, id, config.WebhookDeliveryLogSize)
+	if err != nil {
+		log.Printf("Failed to list deliveries of webhook: %v", id)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (wuc *webhookUseCase) checkModerator(ctx context.Context, roomID string, userID string) error {
+	isModerator, err := wuc.rr.IsModerator(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("Failed to check moderator of room: %v", roomID)
+		return err
+	}
+	if !isModerator {
+		return ErrNotRoomModerator
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	raw := make([]byte, webhookTokenByteLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func hashWebhookToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}